@@ -0,0 +1,214 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Array scans an ARRAY value into a pointer to a slice of any type, and sends a slice as an ARRAY parameter.
+//
+//	var tags []string
+//	err := row.Scan(h2go.Array{V: &tags})
+type Array struct {
+	V interface{}
+}
+
+// Scan implements sql.Scanner
+func (a Array) Scan(src interface{}) error {
+	dv := reflect.ValueOf(a.V)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Slice {
+		return errors.Errorf("can't scan ARRAY into %T: a pointer to a slice is needed", a.V)
+	}
+	return scanArray(dv.Elem(), src)
+}
+
+// Value implements driver.Valuer
+func (a Array) Value() (driver.Value, error) {
+	return convertValue(a.V)
+}
+
+// Int64Array is an ARRAY of integers
+type Int64Array []int64
+
+// Scan implements sql.Scanner
+func (a *Int64Array) Scan(src interface{}) error {
+	return Array{V: (*[]int64)(a)}.Scan(src)
+}
+
+// Value implements driver.Valuer
+func (a Int64Array) Value() (driver.Value, error) {
+	return convertValue([]int64(a))
+}
+
+// Float64Array is an ARRAY of floating point numbers
+type Float64Array []float64
+
+// Scan implements sql.Scanner
+func (a *Float64Array) Scan(src interface{}) error {
+	return Array{V: (*[]float64)(a)}.Scan(src)
+}
+
+// Value implements driver.Valuer
+func (a Float64Array) Value() (driver.Value, error) {
+	return convertValue([]float64(a))
+}
+
+// BoolArray is an ARRAY of booleans
+type BoolArray []bool
+
+// Scan implements sql.Scanner
+func (a *BoolArray) Scan(src interface{}) error {
+	return Array{V: (*[]bool)(a)}.Scan(src)
+}
+
+// Value implements driver.Valuer
+func (a BoolArray) Value() (driver.Value, error) {
+	return convertValue([]bool(a))
+}
+
+// StringArray is an ARRAY of strings
+type StringArray []string
+
+// Scan implements sql.Scanner
+func (a *StringArray) Scan(src interface{}) error {
+	return Array{V: (*[]string)(a)}.Scan(src)
+}
+
+// Value implements driver.Valuer
+func (a StringArray) Value() (driver.Value, error) {
+	return convertValue([]string(a))
+}
+
+// Helpers
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+func scanArray(dst reflect.Value, src interface{}) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	list, ok := src.([]interface{})
+	if !ok {
+		return errors.Errorf("can't scan %T as ARRAY", src)
+	}
+	slice := reflect.MakeSlice(dst.Type(), len(list), len(list))
+	for i, elem := range list {
+		err := assignValue(slice.Index(i), elem)
+		if err != nil {
+			return errors.Wrapf(err, "can't scan array element %d", i)
+		}
+	}
+	dst.Set(slice)
+	return nil
+}
+
+// assignValue stores a value read from the server into an addressable Go value
+func assignValue(dst reflect.Value, src interface{}) error {
+	if dst.CanAddr() && dst.Addr().Type().Implements(scannerType) {
+		return dst.Addr().Interface().(sql.Scanner).Scan(src)
+	}
+	if src == nil {
+		switch dst.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		return errors.Errorf("can't store NULL into %s", dst.Type())
+	}
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dst.Type()) {
+		dst.Set(sv)
+		return nil
+	}
+	switch dst.Kind() {
+	case reflect.Ptr:
+		v := reflect.New(dst.Type().Elem())
+		err := assignValue(v.Elem(), src)
+		if err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	case reflect.Slice:
+		if _, ok := src.([]interface{}); ok {
+			return scanArray(dst, src)
+		}
+	case reflect.String:
+		switch v := src.(type) {
+		case string:
+			dst.SetString(v)
+		case []byte:
+			dst.SetString(string(v))
+		default:
+			dst.SetString(fmt.Sprint(v))
+		}
+		return nil
+	case reflect.Bool:
+		switch v := src.(type) {
+		case bool:
+			dst.SetBool(v)
+			return nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			dst.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(asText(src), 10, dst.Type().Bits())
+		if err != nil {
+			return errors.Wrapf(err, "can't store %v into %s", src, dst.Type())
+		}
+		dst.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(asText(src), 10, dst.Type().Bits())
+		if err != nil {
+			return errors.Wrapf(err, "can't store %v into %s", src, dst.Type())
+		}
+		dst.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(asText(src), dst.Type().Bits())
+		if err != nil {
+			return errors.Wrapf(err, "can't store %v into %s", src, dst.Type())
+		}
+		dst.SetFloat(f)
+		return nil
+	}
+	return errors.Errorf("can't store %T into %s", src, dst.Type())
+}
+
+func asText(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	}
+	return fmt.Sprint(v)
+}
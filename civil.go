@@ -0,0 +1,271 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Date is a calendar date without time zone (DATE). Years can be negative or greater than 9999.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// DateOf gets the date of a time in its location
+func DateOf(t time.Time) Date {
+	year, month, day := t.Date()
+	return Date{Year: year, Month: month, Day: day}
+}
+
+// ParseDate parses a date as [-]YYYY-MM-DD
+func ParseDate(s string) (Date, error) {
+	var d Date
+	text := strings.TrimSpace(s)
+	sign := 1
+	if strings.HasPrefix(text, "-") {
+		sign = -1
+		text = text[1:]
+	}
+	parts := strings.Split(text, "-")
+	if len(parts) != 3 {
+		return d, errors.Errorf("invalid date: %s", s)
+	}
+	year, err1 := strconv.Atoi(parts[0])
+	month, err2 := strconv.Atoi(parts[1])
+	day, err3 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return d, errors.Errorf("invalid date: %s", s)
+	}
+	d = Date{Year: sign * year, Month: time.Month(month), Day: day}
+	if !d.IsValid() {
+		return d, errors.Errorf("invalid date: %s", s)
+	}
+	return d, nil
+}
+
+// IsValid gets if the date exists
+func (d Date) IsValid() bool {
+	return DateOf(d.In(time.UTC)) == d
+}
+
+// In gets the time at the start of the date in a location
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// String gets the date as [-]YYYY-MM-DD
+func (d Date) String() string {
+	year := d.Year
+	sign := ""
+	if year < 0 {
+		sign = "-"
+		year = -year
+	}
+	return fmt.Sprintf("%s%04d-%02d-%02d", sign, year, int(d.Month), d.Day)
+}
+
+// Scan implements sql.Scanner
+func (d *Date) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case Date:
+		*d = v
+	case time.Time:
+		*d = DateOf(v)
+	case LocalDateTime:
+		*d = v.Date
+	case string:
+		*d, err = ParseDate(v)
+	case []byte:
+		*d, err = ParseDate(string(v))
+	case nil:
+		return errors.Errorf("can't scan NULL into Date")
+	default:
+		return errors.Errorf("can't scan %T into Date", src)
+	}
+	return err
+}
+
+// Value implements driver.Valuer
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// TimeOfDay is a time without date nor time zone (TIME)
+type TimeOfDay struct {
+	Hour       int
+	Minute     int
+	Second     int
+	Nanosecond int
+}
+
+// TimeOfDayOf gets the time of day of a time in its location
+func TimeOfDayOf(t time.Time) TimeOfDay {
+	return TimeOfDay{Hour: t.Hour(), Minute: t.Minute(), Second: t.Second(), Nanosecond: t.Nanosecond()}
+}
+
+// ParseTimeOfDay parses a time as HH:MM:SS[.fraction]
+func ParseTimeOfDay(s string) (TimeOfDay, error) {
+	t, err := time.Parse("15:04:05.999999999", strings.TrimSpace(s))
+	if err != nil {
+		return TimeOfDay{}, errors.Errorf("invalid time: %s", s)
+	}
+	return TimeOfDayOf(t), nil
+}
+
+// IsValid gets if the fields are in range
+func (t TimeOfDay) IsValid() bool {
+	return t.Hour >= 0 && t.Hour < 24 && t.Minute >= 0 && t.Minute < 60 &&
+		t.Second >= 0 && t.Second < 60 && t.Nanosecond >= 0 && t.Nanosecond < 1e9
+}
+
+// String gets the time as HH:MM:SS[.fraction]
+func (t TimeOfDay) String() string {
+	s := fmt.Sprintf("%02d:%02d:%02d", t.Hour, t.Minute, t.Second)
+	if t.Nanosecond == 0 {
+		return s
+	}
+	return s + strings.TrimRight(fmt.Sprintf(".%09d", t.Nanosecond), "0")
+}
+
+// Scan implements sql.Scanner
+func (t *TimeOfDay) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case TimeOfDay:
+		*t = v
+	case time.Time:
+		*t = TimeOfDayOf(v)
+	case LocalDateTime:
+		*t = v.Time
+	case string:
+		*t, err = ParseTimeOfDay(v)
+	case []byte:
+		*t, err = ParseTimeOfDay(string(v))
+	case nil:
+		return errors.Errorf("can't scan NULL into TimeOfDay")
+	default:
+		return errors.Errorf("can't scan %T into TimeOfDay", src)
+	}
+	return err
+}
+
+// Value implements driver.Valuer
+func (t TimeOfDay) Value() (driver.Value, error) {
+	return t.String(), nil
+}
+
+// nanos gets the nanoseconds since midnight
+func (t TimeOfDay) nanos() int64 {
+	return (int64(t.Hour)*3600+int64(t.Minute)*60+int64(t.Second))*int64(time.Second) + int64(t.Nanosecond)
+}
+
+func timeOfDayFromNanos(n int64) TimeOfDay {
+	return TimeOfDay{
+		Hour:       int(n / int64(time.Hour)),
+		Minute:     int(n / int64(time.Minute) % 60),
+		Second:     int(n / int64(time.Second) % 60),
+		Nanosecond: int(n % int64(time.Second)),
+	}
+}
+
+// LocalDateTime is a date and time without time zone (TIMESTAMP)
+type LocalDateTime struct {
+	Date Date
+	Time TimeOfDay
+}
+
+// LocalDateTimeOf gets the date and time of a time in its location
+func LocalDateTimeOf(t time.Time) LocalDateTime {
+	return LocalDateTime{Date: DateOf(t), Time: TimeOfDayOf(t)}
+}
+
+// ParseLocalDateTime parses a timestamp as [-]YYYY-MM-DD HH:MM:SS[.fraction] (or with T as separator)
+func ParseLocalDateTime(s string) (LocalDateTime, error) {
+	var dt LocalDateTime
+	text := strings.TrimSpace(s)
+	pos := strings.IndexAny(text, "T ")
+	if pos < 0 {
+		return dt, errors.Errorf("invalid timestamp: %s", s)
+	}
+	var err error
+	dt.Date, err = ParseDate(text[:pos])
+	if err != nil {
+		return dt, errors.Errorf("invalid timestamp: %s", s)
+	}
+	dt.Time, err = ParseTimeOfDay(text[pos+1:])
+	if err != nil {
+		return dt, errors.Errorf("invalid timestamp: %s", s)
+	}
+	return dt, nil
+}
+
+// In gets the time in a location
+func (dt LocalDateTime) In(loc *time.Location) time.Time {
+	return time.Date(dt.Date.Year, dt.Date.Month, dt.Date.Day,
+		dt.Time.Hour, dt.Time.Minute, dt.Time.Second, dt.Time.Nanosecond, loc)
+}
+
+// String gets the timestamp as [-]YYYY-MM-DD HH:MM:SS[.fraction]
+func (dt LocalDateTime) String() string {
+	return dt.Date.String() + " " + dt.Time.String()
+}
+
+// Scan implements sql.Scanner
+func (dt *LocalDateTime) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case LocalDateTime:
+		*dt = v
+	case time.Time:
+		*dt = LocalDateTimeOf(v)
+	case Date:
+		*dt = LocalDateTime{Date: v}
+	case string:
+		*dt, err = ParseLocalDateTime(v)
+	case []byte:
+		*dt, err = ParseLocalDateTime(string(v))
+	case nil:
+		return errors.Errorf("can't scan NULL into LocalDateTime")
+	default:
+		return errors.Errorf("can't scan %T into LocalDateTime", src)
+	}
+	return err
+}
+
+// Value implements driver.Valuer
+func (dt LocalDateTime) Value() (driver.Value, error) {
+	return dt.String(), nil
+}
+
+// H2 date values: year << 9 | month << 5 | day
+
+func (d Date) dateValue() int64 {
+	return int64(d.Year)<<9 | int64(d.Month)<<5 | int64(d.Day)
+}
+
+func dateFromValue(n int64) Date {
+	return Date{Year: int(n >> 9), Month: time.Month((n >> 5) & 0xf), Day: int(n & 0x1f)}
+}
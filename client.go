@@ -17,9 +17,10 @@ limitations under the License.
 package h2go
 
 import (
+	"context"
+	"database/sql/driver"
 	"net"
-
-	log "github.com/sirupsen/logrus"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -28,9 +29,18 @@ type h2client struct {
 	conn  net.Conn
 	trans transfer
 	sess  session
+	// Hook of the operations, nil for none
+	hook Hook
+	// Address of the server
+	server string
+	// Other nodes of a cluster, also sent the updates
+	replicas []*clusterNode
+	// In cluster mode, auto-commit is done by the client
+	cluster    bool
+	autoCommit bool
 }
 
-func (c *h2client) doHandshake(ci h2connInfo) error {
+func (c *h2client) doHandshake(cfg *Config) error {
 	var err error
 	// 1. send min client version
 	err = c.trans.writeInt32(9)
@@ -43,22 +53,22 @@ func (c *h2client) doHandshake(ci h2connInfo) error {
 		return errors.Wrapf(err, "H2 handshake: can't send max client version")
 	}
 	// 3. Send db name
-	err = c.trans.writeString(ci.database)
+	err = c.trans.writeString(cfg.Database)
 	if err != nil {
 		return errors.Wrapf(err, "H2 handshake: can't send database name")
 	}
 	// 4. Send original url
-	err = c.trans.writeString("jdbc:h2:" + ci.database)
+	err = c.trans.writeString(cfg.jdbcURL())
 	if err != nil {
 		return errors.Wrapf(err, "H2 handshake: can't send original url")
 	}
 	// 5. Send username
-	err = c.trans.writeString(ci.username)
+	err = c.trans.writeString(cfg.User)
 	if err != nil {
 		return errors.Wrapf(err, "H2 handshake: can't send username")
 	}
 	// 6. Send password
-	hashedPassword, err := getHashedPassword(ci.username, ci.password)
+	hashedPassword, err := getHashedPassword(cfg.User, cfg.Password)
 	if err != nil {
 		return errors.Wrapf(err, "H2 handshake: can't hash password")
 	}
@@ -72,11 +82,21 @@ func (c *h2client) doHandshake(ci h2connInfo) error {
 		return errors.Wrapf(err, "H2 handshake: can't send hashed file password")
 	}
 	// 8. Send aditional properties
-	// TODO: bynow, 0 properties tos send
-	err = c.trans.writeInt32(0)
+	names := cfg.propertyNames()
+	err = c.trans.writeInt32(int32(len(names)))
 	if err != nil {
 		return errors.Wrapf(err, "H2 handshake: can't send properties")
 	}
+	for _, name := range names {
+		err = c.trans.writeString(name)
+		if err != nil {
+			return errors.Wrapf(err, "H2 handshake: can't send property name")
+		}
+		err = c.trans.writeString(cfg.Properties[name])
+		if err != nil {
+			return errors.Wrapf(err, "H2 handshake: can't send property value")
+		}
+	}
 	err = c.trans.flush()
 	if err != nil {
 		return errors.Wrapf(err, "H2 handshake: can't flush data to socket")
@@ -91,11 +111,13 @@ func (c *h2client) doHandshake(ci h2connInfo) error {
 	if err != nil {
 		return errors.Wrapf(err, "H2 handshake: can't get H2 Server client version ack")
 	}
-	L(log.InfoLevel, "H2 server code: %d - client ver: %d", code, clientVer)
+	c.trans.L(LogInfo, "H2 server code: %d - client ver: %d", code, clientVer)
+	c.trans.version = clientVer
 	return nil
 }
 
 func (c *h2client) close() error {
+	c.closeReplicas()
 	err := c.sess.close(&c.trans)
 	if err != nil {
 		return err
@@ -103,3 +125,36 @@ func (c *h2client) close() error {
 	// Close client
 	return c.conn.Close()
 }
+
+// setTimeZone sets the session time zone, used by the server to convert values with and without time zone
+func (c *h2client) setTimeZone(loc *time.Location) error {
+	name := loc.String()
+	if name == "Local" {
+		return errors.Errorf("the local time zone has no name; use its IANA name in loc")
+	}
+	_, err := c.execOnce("SET TIME ZONE '" + name + "'")
+	return err
+}
+
+// checkContext checks the context isn't done before starting an operation
+func (c *h2client) checkContext(ctx context.Context) error {
+	err := ctx.Err()
+	if err != nil {
+		c.trans.stats.add(statCancels, 1)
+	}
+	return err
+}
+
+// execOnce runs a statement without parameters and closes it on the server
+func (c *h2client) execOnce(sql string) (int32, error) {
+	st, err := c.prepareAll(sql)
+	if err != nil {
+		return -1, err
+	}
+	nUpdated, err := c.executeUpdate(&st, []driver.Value{})
+	errClose := c.closeCommand(st.id)
+	if err != nil {
+		return -1, err
+	}
+	return nUpdated, errClose
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// H2 cluster mode: the client connects to every node, sends them the updates and the transaction
+// control, and runs the queries in the first one. The server auto-commit is off in all the nodes,
+// and the client commits after each update in auto-commit mode. If a node fails, it's dropped and
+// the cluster is disabled in the others (SET CLUSTER ''), as the H2 JDBC client does.
+
+// clusterNode is a node of a cluster other than the one running the queries
+type clusterNode struct {
+	server string
+	conn   net.Conn
+	trans  transfer
+}
+
+// connectCluster connects to all the nodes of a cluster
+func connectCluster(ctx context.Context, cfg *Config, st *stats) (driver.Conn, error) {
+	// Nodes of a running cluster reject the sessions not in cluster mode
+	nodeCfg := cfg.Clone()
+	if nodeCfg.Properties == nil {
+		nodeCfg.Properties = map[string]string{}
+	}
+	nodeCfg.Properties["CLUSTER"] = "TRUE"
+	nodeCfg.RandomHosts = false
+	servers := nodeCfg.servers()
+	var nodes []*h2Conn
+	var errs []string
+	for _, server := range servers {
+		conn, err := connectTo(ctx, nodeCfg, st, server)
+		if err != nil {
+			st.add(statBadConns, 1)
+			newLogger(cfg).L(LogWarn, "Can't connect to cluster node %s: %s", server, err)
+			errs = append(errs, server+": "+err.Error())
+			continue
+		}
+		nodes = append(nodes, conn)
+	}
+	if len(nodes) == 0 {
+		return nil, errors.Errorf("can't connect to any H2 cluster node: %s", strings.Join(errs, "; "))
+	}
+	h2c := nodes[0]
+	c := h2c.client
+	for _, node := range nodes[1:] {
+		c.replicas = append(c.replicas, &clusterNode{server: node.client.server, conn: node.client.conn, trans: node.client.trans})
+	}
+	var err error
+	if len(errs) > 0 {
+		err = c.switchOffCluster()
+	} else if len(c.replicas) > 0 {
+		err = c.enableCluster(strings.Join(servers, ","))
+	}
+	if err != nil {
+		c.close()
+		return nil, errors.Wrapf(err, "can't set cluster mode")
+	}
+	return h2c, nil
+}
+
+// enableCluster turns off the server auto-commit and sets the cluster servers
+func (c *h2client) enableCluster(servers string) error {
+	_, err := c.execOnce("SET AUTOCOMMIT FALSE")
+	if err != nil {
+		return err
+	}
+	_, err = c.execOnce("SET CLUSTER '" + strings.Replace(servers, "'", "''", -1) + "'")
+	if err != nil {
+		return err
+	}
+	c.cluster = true
+	c.autoCommit = true
+	return nil
+}
+
+// switchOffCluster disables the cluster in the nodes left, after a node failed
+func (c *h2client) switchOffCluster() error {
+	c.trans.L(LogWarn, "Disabling the cluster")
+	_, err := c.execOnce("SET CLUSTER ''")
+	return err
+}
+
+// nodeFailures are the nodes that failed while a command was sent to the cluster
+type nodeFailures struct {
+	nodes  []*clusterNode
+	causes []error
+}
+
+func (f *nodeFailures) add(node *clusterNode, cause error) {
+	f.nodes = append(f.nodes, node)
+	f.causes = append(f.causes, cause)
+}
+
+// dropNodes closes the failed nodes of the cluster and disables it in the nodes left. It's called
+// once the command is done in all the nodes, as disabling the cluster sends other commands.
+func (c *h2client) dropNodes(failed *nodeFailures) {
+	dropped := false
+	for i, node := range failed.nodes {
+		for j, replica := range c.replicas {
+			if replica != node {
+				continue
+			}
+			c.trans.L(LogError, "Cluster node %s failed: %s", node.server, failed.causes[i])
+			c.trans.stats.add(statBadConns, 1)
+			node.conn.Close()
+			c.replicas = append(c.replicas[:j], c.replicas[j+1:]...)
+			dropped = true
+			break
+		}
+	}
+	if !dropped {
+		return
+	}
+	err := c.switchOffCluster()
+	if err != nil {
+		c.trans.L(LogError, "Can't disable the cluster: %s", err)
+	}
+}
+
+// prepareAll prepares a statement in all the nodes
+func (c *h2client) prepareAll(sql string) (h2stmt, error) {
+	stmt, err := c.sess.prepare2(&c.trans, sql)
+	if err != nil {
+		return h2stmt{}, err
+	}
+	st, _ := stmt.(h2stmt)
+	var failed nodeFailures
+	defer c.dropNodes(&failed)
+	for _, node := range c.replicas {
+		_, err = c.sess.prepareAs(&node.trans, st.id, sql)
+		if isSQLError(err) {
+			c.closeCommand(st.id)
+			return h2stmt{}, errors.Wrapf(err, "cluster node %s", node.server)
+		}
+		if err != nil {
+			failed.add(node, err)
+		}
+	}
+	return st, nil
+}
+
+// executeUpdate runs an update in all the nodes and checks they updated the same rows
+func (c *h2client) executeUpdate(stmt *h2stmt, values []driver.Value) (int32, error) {
+	var marks []int64
+	if len(c.replicas) > 0 {
+		var err error
+		marks, err = markValues(values)
+		if err != nil {
+			return -1, err
+		}
+	}
+	nUpdated, err := c.sess.executeQueryUpdate(stmt, &c.trans, values)
+	if err != nil {
+		return -1, err
+	}
+	err = c.updateReplicas(stmt, values, marks, nUpdated)
+	if err != nil {
+		return -1, err
+	}
+	if c.cluster && c.autoCommit {
+		err = c.commitAll()
+	}
+	return nUpdated, err
+}
+
+// updateReplicas runs an update in the other nodes and checks they updated the same rows
+func (c *h2client) updateReplicas(stmt *h2stmt, values []driver.Value, marks []int64, nUpdated int32) error {
+	var failed nodeFailures
+	defer c.dropNodes(&failed)
+	for _, node := range c.replicas {
+		err := rewindValues(values, marks)
+		if err != nil {
+			return errors.Wrapf(err, "can't send parameters to cluster node %s", node.server)
+		}
+		n, err := c.sess.executeQueryUpdate(stmt, &node.trans, values)
+		if isSQLError(err) {
+			return errors.Wrapf(err, "cluster node %s", node.server)
+		}
+		if err != nil {
+			failed.add(node, err)
+			continue
+		}
+		if n != nUpdated {
+			return errors.Errorf("cluster nodes out of sync: %d rows updated in %s, %d in %s",
+				nUpdated, c.server, n, node.server)
+		}
+	}
+	return nil
+}
+
+// commitAll commits in all the nodes
+func (c *h2client) commitAll() error {
+	err := c.sess.commit(&c.trans)
+	if err != nil {
+		return err
+	}
+	var failed nodeFailures
+	defer c.dropNodes(&failed)
+	for _, node := range c.replicas {
+		err = c.sess.commit(&node.trans)
+		if isSQLError(err) {
+			return errors.Wrapf(err, "cluster node %s", node.server)
+		}
+		if err != nil {
+			failed.add(node, err)
+		}
+	}
+	return nil
+}
+
+// closeCommand closes a statement in all the nodes
+func (c *h2client) closeCommand(id int32) error {
+	var failed nodeFailures
+	defer c.dropNodes(&failed)
+	for _, node := range c.replicas {
+		err := c.sess.closeCommand(&node.trans, id)
+		if err != nil {
+			failed.add(node, err)
+		}
+	}
+	return c.sess.closeCommand(&c.trans, id)
+}
+
+// setAutoCommit sets the auto-commit mode, done by the client in a cluster
+func (c *h2client) setAutoCommit(on bool) error {
+	if c.cluster {
+		c.autoCommit = on
+		return nil
+	}
+	sql := "SET AUTOCOMMIT FALSE"
+	if on {
+		sql = "SET AUTOCOMMIT TRUE"
+	}
+	_, err := c.execOnce(sql)
+	return err
+}
+
+// closeReplicas closes the other nodes of the cluster
+func (c *h2client) closeReplicas() {
+	for _, node := range c.replicas {
+		err := c.sess.close(&node.trans)
+		if err != nil {
+			node.conn.Close()
+		}
+	}
+	c.replicas = nil
+}
+
+// Helpers
+
+func isSQLError(err error) bool {
+	_, ok := errors.Cause(err).(*h2error)
+	return ok
+}
+
+// markValues gets the positions of the streams of the parameters, to send them again
+func markValues(values []driver.Value) ([]int64, error) {
+	marks := make([]int64, len(values))
+	for i, value := range values {
+		marks[i] = -1
+		if lob, ok := value.(*Lob); ok {
+			// Stored LOBs are references to a node; in memory ones are sent again from their data
+			if lob.data == nil {
+				return nil, errors.Errorf("parameter %d: LOB values can't be sent to a cluster", i+1)
+			}
+			continue
+		}
+		if _, ok := value.(io.Reader); !ok {
+			continue
+		}
+		seeker, ok := value.(io.Seeker)
+		if !ok {
+			return nil, errors.Errorf("parameter %d: streams must implement io.Seeker to be sent to a cluster", i+1)
+		}
+		pos, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parameter %d", i+1)
+		}
+		marks[i] = pos
+	}
+	return marks, nil
+}
+
+// rewindValues moves the streams of the parameters back to their marks
+func rewindValues(values []driver.Value, marks []int64) error {
+	for i, value := range values {
+		if marks[i] < 0 {
+			continue
+		}
+		_, err := value.(io.Seeker).Seek(marks[i], io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
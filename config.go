@@ -0,0 +1,516 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql/driver"
+	"math/rand"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultDatabase = "~/test"
+	jdbcPrefix      = "jdbc:h2:"
+)
+
+// Dialer opens the network connections to the H2 server. *net.Dialer implements it.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Config is the configuration of the connections to a H2 server
+type Config struct {
+	// Server address: 127.0.0.1:9092 by default
+	Host string
+	Port int
+	// Failover servers (host or host:port) tried when the previous ones can't be connected
+	Hosts []string
+	// Try the servers in random order instead of Host first
+	RandomHosts bool
+	// Connect to Host and all the Hosts as the nodes of an H2 cluster, instead of failover
+	Cluster bool
+	// Database name or path, as "~/test" or "mem:test" for in-memory databases. In a connection
+	// string, it's the URL path (with its leading slash) or the database option.
+	Database string
+	User     string
+	Password string
+
+	// TLS configuration for servers started with -tcpSSL; nil for plain TCP
+	TLSConfig *tls.Config
+	// Timeouts of connecting to each server and of each read and write on the connection; 0 for none
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// Logger of the driver messages up to LogLevel; nil for no logging
+	Logger   Logger
+	LogLevel LogLevel
+	// Connection settings sent in the handshake (like MODE or IFEXISTS)
+	Properties map[string]string
+	// Dialer of the connections; a net.Dialer by default
+	Dialer Dialer
+	// Name of a dial function registered with RegisterDialContext, when there isn't a Dialer
+	Net string
+	// TCP keep-alive period: 0 for the default (15s), negative to disable it
+	KeepAlive time.Duration
+	// Enable the Nagle's algorithm, disabled by default with TCP_NODELAY
+	DisableNoDelay bool
+	// Hook called around the operations of the connections
+	Hook Hook
+
+	// Location of DATE and TIMESTAMP values without time zone; UTC if nil
+	Loc *time.Location
+	// Set the session TIME ZONE to Loc
+	SyncTimeZone bool
+	// Return DATE, TIME and TIMESTAMP as Date, TimeOfDay and LocalDateTime
+	Civil bool
+	// Return ENUM values as Enum instead of their labels
+	EnumOrdinals bool
+	// Return the LOBs over 1 MiB as *Lob, to stream them while the rows are open
+	StreamLobs bool
+
+	// JDBC URL the configuration was parsed from
+	url string
+}
+
+// NewConfig creates a configuration with the default values
+func NewConfig() *Config {
+	return &Config{Host: "127.0.0.1", Port: defaultH2port, Database: defaultDatabase}
+}
+
+// ParseDSN parses a connection string as h2://user:password@host:port/database?option=value
+// or as a JDBC URL: jdbc:h2:tcp://host:port/database;USER=user;PASSWORD=password;KEY=VALUE
+func ParseDSN(dsn string) (*Config, error) {
+	if strings.HasPrefix(strings.ToLower(dsn), jdbcPrefix) {
+		return parseJDBC(dsn)
+	}
+	cfg := NewConfig()
+	dsn, hosts := splitHosts(dsn)
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse connection url")
+	}
+	// Set host
+	if host := u.Hostname(); len(host) > 0 {
+		cfg.Host = host
+	}
+	// Set port
+	if port, _ := strconv.Atoi(u.Port()); port != 0 {
+		cfg.Port = port
+	}
+	// Set failover hosts
+	for _, host := range hosts {
+		_, _, err = splitServer(host, cfg.Port)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Hosts = append(cfg.Hosts, host)
+	}
+	// Set database
+	if len(u.Path) > 0 {
+		cfg.Database = u.Path
+	}
+	// Names that aren't a URL path, as "~/test"; set before mem applies to it
+	query := u.Query()
+	if database := query.Get("database"); database != "" {
+		cfg.Database = database
+	}
+	// Username & password
+	userinfo := u.User
+	if userinfo != nil {
+		cfg.User = userinfo.Username()
+		if pass, ok := userinfo.Password(); ok {
+			cfg.Password = pass
+		}
+	}
+	for k, v := range query {
+		var val string
+		if len(v) > 0 {
+			val = strings.TrimSpace(v[0])
+		}
+		switch strings.ToLower(k) {
+		case "database":
+			// Already set
+		case "mem":
+			if isTrue(val) {
+				cfg.Database = "mem:" + strings.Replace(cfg.Database, "/", "", 1)
+			}
+		case "logging":
+			cfg.LogLevel, err = ParseLogLevel(val)
+			if err == nil && cfg.LogLevel > LogNone {
+				cfg.Logger = NewStdLogger(nil)
+			}
+		case "civil":
+			cfg.Civil = isTrue(val)
+		case "enumordinals":
+			cfg.EnumOrdinals = isTrue(val)
+		case "streamlobs":
+			cfg.StreamLobs = isTrue(val)
+		case "loc":
+			cfg.Loc, err = time.LoadLocation(val)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid location: %s", val)
+			}
+		case "synctz":
+			cfg.SyncTimeZone = isTrue(val)
+		case "tls":
+			switch strings.ToLower(val) {
+			case "skip-verify":
+				cfg.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+			default:
+				if isTrue(val) {
+					cfg.TLSConfig = &tls.Config{}
+				}
+			}
+		case "timeout":
+			cfg.DialTimeout, err = time.ParseDuration(val)
+		case "readtimeout":
+			cfg.ReadTimeout, err = time.ParseDuration(val)
+		case "writetimeout":
+			cfg.WriteTimeout, err = time.ParseDuration(val)
+		case "net":
+			cfg.Net = val
+		case "keepalive":
+			cfg.KeepAlive, err = time.ParseDuration(val)
+		case "nodelay":
+			cfg.DisableNoDelay = !isTrue(val)
+		case "cluster":
+			cfg.Cluster = isTrue(val)
+		case "hostorder":
+			switch strings.ToLower(val) {
+			case "random":
+				cfg.RandomHosts = true
+			case "sequential":
+				cfg.RandomHosts = false
+			default:
+				err = errors.Errorf("unknown order")
+			}
+		default:
+			return nil, errors.Errorf("unknown H2 server connection parameters => \"%s\" : \"%s\"", k, val)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value of %s: %s", k, val)
+		}
+	}
+	return cfg, nil
+}
+
+// FormatDSN formats the configuration as a connection string. Properties, the dialer and
+// custom TLS settings can't be represented in it.
+func (cfg *Config) FormatDSN() string {
+	u := url.URL{Scheme: "h2", Host: strings.Join(append([]string{cfg.address()}, cfg.Hosts...), ",")}
+	if cfg.Password != "" {
+		u.User = url.UserPassword(cfg.User, cfg.Password)
+	} else if cfg.User != "" {
+		u.User = url.User(cfg.User)
+	}
+	q := url.Values{}
+	database := cfg.Database
+	switch {
+	case strings.HasPrefix(database, "mem:"):
+		// mem drops the leading slash of the path
+		u.Path = "/" + strings.TrimPrefix(database, "mem:")
+		q.Set("mem", "true")
+	case strings.HasPrefix(database, "/"):
+		u.Path = database
+	case database != defaultDatabase && database != "":
+		q.Set("database", database)
+	}
+	if cfg.Logger != nil {
+		q.Set("logging", cfg.LogLevel.String())
+	}
+	if cfg.Civil {
+		q.Set("civil", "true")
+	}
+	if cfg.EnumOrdinals {
+		q.Set("enumordinals", "true")
+	}
+	if cfg.StreamLobs {
+		q.Set("streamlobs", "true")
+	}
+	if cfg.Loc != nil {
+		q.Set("loc", cfg.Loc.String())
+	}
+	if cfg.SyncTimeZone {
+		q.Set("synctz", "true")
+	}
+	if cfg.TLSConfig != nil {
+		if cfg.TLSConfig.InsecureSkipVerify {
+			q.Set("tls", "skip-verify")
+		} else {
+			q.Set("tls", "true")
+		}
+	}
+	if cfg.DialTimeout > 0 {
+		q.Set("timeout", cfg.DialTimeout.String())
+	}
+	if cfg.ReadTimeout > 0 {
+		q.Set("readTimeout", cfg.ReadTimeout.String())
+	}
+	if cfg.WriteTimeout > 0 {
+		q.Set("writeTimeout", cfg.WriteTimeout.String())
+	}
+	if cfg.Net != "" {
+		q.Set("net", cfg.Net)
+	}
+	if cfg.KeepAlive != 0 {
+		q.Set("keepalive", cfg.KeepAlive.String())
+	}
+	if cfg.DisableNoDelay {
+		q.Set("nodelay", "false")
+	}
+	if cfg.RandomHosts {
+		q.Set("hostorder", "random")
+	}
+	if cfg.Cluster {
+		q.Set("cluster", "true")
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Clone gets a copy of the configuration
+func (cfg *Config) Clone() *Config {
+	c := *cfg
+	if cfg.TLSConfig != nil {
+		c.TLSConfig = cfg.TLSConfig.Clone()
+	}
+	if cfg.Hosts != nil {
+		c.Hosts = append([]string(nil), cfg.Hosts...)
+	}
+	if cfg.Properties != nil {
+		c.Properties = make(map[string]string, len(cfg.Properties))
+		for k, v := range cfg.Properties {
+			c.Properties[k] = v
+		}
+	}
+	return &c
+}
+
+// Connector is a driver.Connector with the statistics of its connections
+type Connector interface {
+	driver.Connector
+	Stats() Stats
+}
+
+// NewConnector creates a connector to use with sql.OpenDB
+func NewConnector(cfg *Config) (Connector, error) {
+	if cfg == nil {
+		return nil, errors.Errorf("missing H2 configuration")
+	}
+	c := cfg.Clone()
+	defaults := NewConfig()
+	if c.Host == "" {
+		c.Host = defaults.Host
+	}
+	if c.Port == 0 {
+		c.Port = defaults.Port
+	}
+	if c.Database == "" {
+		c.Database = defaults.Database
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return nil, errors.Errorf("invalid port: %d", c.Port)
+	}
+	return &h2Connector{cfg: c, logger: newLogger(c), stats: newStats(), driver: h2Driver{}}, nil
+}
+
+// Helpers
+
+// parseJDBC parses a JDBC URL of a remote database (tcp:// or ssl://). The settings other
+// than USER and PASSWORD are sent as properties in the handshake.
+func parseJDBC(dsn string) (*Config, error) {
+	cfg := NewConfig()
+	rest := dsn[len(jdbcPrefix):]
+	protocol := strings.ToLower(rest[:strings.Index(rest+"/", "/")])
+	switch protocol {
+	case "tcp:":
+	case "ssl:":
+		cfg.TLSConfig = &tls.Config{}
+	default:
+		return nil, errors.Errorf("unsupported H2 URL: only tcp:// and ssl:// databases can be used")
+	}
+	if !strings.HasPrefix(rest[len(protocol):], "//") {
+		return nil, errors.Errorf("invalid H2 URL: missing server")
+	}
+	settings := strings.Split(rest[len(protocol)+2:], ";")
+	// 1. Server and database name
+	pos := strings.Index(settings[0], "/")
+	if pos < 0 || pos == len(settings[0])-1 {
+		return nil, errors.Errorf("missing database name in H2 URL")
+	}
+	server := settings[0][:pos]
+	cfg.Database = settings[0][pos+1:]
+	if server != "" {
+		// Several servers are the nodes of a cluster
+		servers := strings.Split(server, ",")
+		var err error
+		cfg.Host, cfg.Port, err = splitServer(servers[0], cfg.Port)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range servers[1:] {
+			_, _, err = splitServer(s, cfg.Port)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Hosts = append(cfg.Hosts, s)
+		}
+		cfg.Cluster = len(cfg.Hosts) > 0
+	}
+	// 2. Settings
+	original := dsn[:len(dsn)-len(rest)] + rest[:len(protocol)+2] + settings[0]
+	for _, setting := range settings[1:] {
+		if setting == "" {
+			continue
+		}
+		pos := strings.Index(setting, "=")
+		if pos < 0 {
+			return nil, errors.Errorf("invalid setting in H2 URL: %s", setting)
+		}
+		key := strings.ToUpper(strings.TrimSpace(setting[:pos]))
+		val := setting[pos+1:]
+		switch key {
+		case "USER":
+			cfg.User = val
+		case "PASSWORD":
+			cfg.Password = val
+			// Not sent in the original URL
+			continue
+		default:
+			if cfg.Properties == nil {
+				cfg.Properties = map[string]string{}
+			}
+			cfg.Properties[key] = val
+		}
+		original += ";" + setting
+	}
+	cfg.url = original
+	return cfg, nil
+}
+
+// jdbcURL gets the original URL sent in the handshake
+func (cfg *Config) jdbcURL() string {
+	if cfg.url != "" {
+		return cfg.url
+	}
+	protocol := "tcp://"
+	if cfg.TLSConfig != nil {
+		protocol = "ssl://"
+	}
+	return jdbcPrefix + protocol + cfg.address() + "/" + cfg.Database
+}
+
+// address gets the server address
+func (cfg *Config) address() string {
+	return net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+}
+
+// servers gets the addresses of the servers in the order they're tried
+func (cfg *Config) servers() []string {
+	servers := []string{cfg.address()}
+	for _, server := range cfg.Hosts {
+		host, port, err := splitServer(server, cfg.Port)
+		if err == nil {
+			servers = append(servers, net.JoinHostPort(host, strconv.Itoa(port)))
+		}
+	}
+	if cfg.RandomHosts {
+		shuffleLock.Lock()
+		shuffle.Shuffle(len(servers), func(i, j int) {
+			servers[i], servers[j] = servers[j], servers[i]
+		})
+		shuffleLock.Unlock()
+	}
+	return servers
+}
+
+var (
+	shuffleLock sync.Mutex
+	shuffle     = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// splitServer splits a server as host[:port], with the default port if it's missing
+func splitServer(server string, defPort int) (string, int, error) {
+	host := server
+	port := defPort
+	// IPv6 addresses with port are enclosed in brackets
+	hasPort := strings.Contains(server, "]:")
+	if !strings.HasPrefix(server, "[") {
+		hasPort = strings.Count(server, ":") == 1
+	}
+	if hasPort {
+		h, p, err := net.SplitHostPort(server)
+		if err != nil {
+			return "", 0, errors.Wrapf(err, "invalid server %s", server)
+		}
+		port, err = strconv.Atoi(p)
+		if err != nil || port <= 0 || port > 65535 {
+			return "", 0, errors.Errorf("invalid port of server %s", server)
+		}
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "" {
+		return "", 0, errors.Errorf("invalid server %s", server)
+	}
+	return host, port, nil
+}
+
+// splitHosts removes the failover hosts from a connection string
+func splitHosts(dsn string) (string, []string) {
+	start := strings.Index(dsn, "://")
+	if start < 0 {
+		return dsn, nil
+	}
+	start += 3
+	end := strings.IndexAny(dsn[start:], "/?#")
+	if end < 0 {
+		end = len(dsn)
+	} else {
+		end += start
+	}
+	start += strings.LastIndex(dsn[start:end], "@") + 1
+	hosts := strings.Split(dsn[start:end], ",")
+	if len(hosts) == 1 {
+		return dsn, nil
+	}
+	return dsn[:start] + hosts[0] + dsn[end:], hosts[1:]
+}
+
+// propertyNames gets the names of the handshake properties in order
+func (cfg *Config) propertyNames() []string {
+	names := make([]string, 0, len(cfg.Properties))
+	for k := range cfg.Properties {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isTrue(val string) bool {
+	return val == "" || val == "1" || val == "yes" || val == "true"
+}
@@ -19,11 +19,7 @@ package h2go
 import (
 	"context"
 	"database/sql/driver"
-	"fmt"
-
-	"net"
-
-	log "github.com/sirupsen/logrus"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -31,8 +27,8 @@ import (
 const defaultH2port = 9092
 
 type h2Conn struct {
-	connInfo h2connInfo
-	client   h2client
+	cfg    *Config
+	client *h2client
 
 	// Interfaces
 	driver.Conn
@@ -41,19 +37,32 @@ type h2Conn struct {
 	driver.QueryerContext
 	driver.ExecerContext
 	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.NamedValueChecker
+}
+
+// Server gets the address (host:port) of the server of the connection
+func (h2c h2Conn) Server() string {
+	return h2c.client.server
 }
 
 // Pinger interface
 func (h2c h2Conn) Ping(ctx context.Context) error {
-	L(log.DebugLevel, "Ping")
+	h2c.client.trans.L(LogDebug, "Ping")
 	var err error
 	stmt, err := h2c.client.sess.prepare(&h2c.client.trans, "SELECT 1")
 	if err != nil {
+		h2c.client.trans.stats.add(statBadConns, 1)
 		return driver.ErrBadConn
 	}
 	st, _ := stmt.(h2stmt)
-	_, _, err = h2c.client.sess.executeQuery(&st, &h2c.client.trans)
+	res, err := h2c.client.sess.executeQuery(&st, &h2c.client.trans, nil)
+	if err == nil {
+		res.closeStatement(st.id)
+		err = res.Close()
+	}
 	if err != nil {
+		h2c.client.trans.stats.add(statBadConns, 1)
 		return driver.ErrBadConn
 	}
 	return nil
@@ -62,95 +71,222 @@ func (h2c h2Conn) Ping(ctx context.Context) error {
 // Validator interface
 func (h2c h2Conn) IsValid() bool {
 	// TODO: check for real valid connection
-	L(log.DebugLevel, "IsValid")
+	h2c.client.trans.L(LogDebug, "IsValid")
 	return true
 }
 
 // Conn interface
 func (h2c h2Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
-	L(log.DebugLevel, "BeginTx")
-	// Set autocommit to false
-	stmt, err := h2c.client.sess.prepare2(&h2c.client.trans, "SET AUTOCOMMIT FALSE")
+	h2c.client.trans.L(LogDebug, "BeginTx")
+	err := h2c.client.checkContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	st, _ := stmt.(h2stmt)
-	_, err = h2c.client.sess.executeQueryUpdate(&st, &h2c.client.trans, []driver.Value{})
+	// Set autocommit to false
+	err = h2c.client.setAutoCommit(false)
 	if err != nil {
 		return nil, err
 	}
-	return &h2tx{conn: h2c}, nil
+	return &h2tx{conn: h2c, ctx: ctx}, nil
 }
 func (h2c *h2Conn) Close() error {
-	L(log.DebugLevel, "Close conn")
+	h2c.client.trans.L(LogDebug, "Close conn")
 
 	return h2c.client.close()
 }
 
 func (h2c *h2Conn) Prepare(query string) (driver.Stmt, error) {
-	L(log.DebugLevel, "Prepare: %s", query)
+	return h2c.PrepareContext(context.Background(), query)
+}
+
+// ConnPrepareContext interface
+func (h2c *h2Conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	h2c.client.trans.L(LogDebug, "Prepare: %s", query)
+	err := h2c.client.checkContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hc := startHook(ctx, h2c.client.hook, OpPrepare, query, 0)
+	stmt, err := h2c.prepare(query)
+	hc.end(0, err)
+	return stmt, err
+}
+
+func (h2c *h2Conn) prepare(query string) (driver.Stmt, error) {
 	var err error
-	stmt, err := h2c.client.sess.prepare2(&h2c.client.trans, query)
+	nq, err := parseNamedQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	// @name alone can be an H2 user variable: it's decided when the arguments are bound
+	sql := query
+	if nq.hasColon {
+		sql = nq.query
+	}
+	h2stmtIns, err := h2c.client.prepareAll(sql)
 	if err != nil {
 		return nil, err
 	}
-	h2stmtIns := stmt.(h2stmt)
 	h2stmtIns.client = h2c.client
 	h2stmtIns.query = query
+	if nq.hasColon {
+		h2stmtIns.names = nq.names
+	}
+	if nq.hasAt && !nq.hasColon {
+		h2stmtIns.atNames = &namedStmt{nq: nq}
+	}
 	return h2stmtIns, nil
 }
 
+// NamedValueChecker interface
+func (h2c *h2Conn) CheckNamedValue(nv *driver.NamedValue) error {
+	// Parameter types are unknown until the query is prepared
+	return checkNamedValue(nv)
+}
+
 // QuerierContext interface
 func (h2c *h2Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
-	L(log.DebugLevel, "QueryContext: %s", query)
+	h2c.client.trans.L(LogDebug, "QueryContext: %s", query)
+	err := h2c.client.checkContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hc := startHook(ctx, h2c.client.hook, OpQuery, query, len(args))
+	res, err := h2c.query(query, args)
+	if err != nil {
+		hc.end(0, err)
+		return nil, err
+	}
+	res.ctx = hc.context(ctx)
+	hc.end(int64(len(res.rows)), nil)
+	return res, nil
+}
+
+func (h2c *h2Conn) query(query string, args []driver.NamedValue) (*h2Result, error) {
 	var err error
-	stmt, err := h2c.client.sess.prepare(&h2c.client.trans, query)
+	sql, args, err := rewriteNamed(query, args)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := h2c.client.sess.prepare2(&h2c.client.trans, sql)
 	if err != nil {
 		return nil, err
 	}
 	st, _ := stmt.(h2stmt)
-	cols, nRows, err := h2c.client.sess.executeQuery(&st, &h2c.client.trans)
+	argsValues, err := st.bindValues(args)
+	if err != nil {
+		h2c.client.sess.closeCommand(&h2c.client.trans, st.id)
+		return nil, err
+	}
+	res, err := h2c.client.sess.executeQuery(&st, &h2c.client.trans, argsValues)
 	if err != nil {
+		h2c.client.sess.closeCommand(&h2c.client.trans, st.id)
 		return nil, err
 	}
-	return &h2Result{query: query, columns: cols, numRows: nRows, trans: &h2c.client.trans, curRow: 0}, nil
+	err = res.closeStatement(st.id)
+	if err != nil {
+		return nil, err
+	}
+	res.query = query
+	res.client = h2c.client
+	return res, nil
 }
 
 func (h2c *h2Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
-	L(log.DebugLevel, "ExecContext: %s", query)
+	h2c.client.trans.L(LogDebug, "ExecContext: %s", query)
+	err := h2c.client.checkContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hc := startHook(ctx, h2c.client.hook, OpExec, query, len(args))
+	res, err := h2c.exec(query, args)
+	if err != nil {
+		hc.end(0, err)
+		return nil, err
+	}
+	hc.end(int64(res.nUpdated), nil)
+	return res, nil
+}
+
+func (h2c *h2Conn) exec(query string, args []driver.NamedValue) (*h2ExecResult, error) {
 	var err error
-	var argsValues []driver.Value
-	for _, arg := range args {
-		argsValues = append(argsValues, arg.Value)
+	sql, args, err := rewriteNamed(query, args)
+	if err != nil {
+		return nil, err
 	}
-	stmt, err := h2c.client.sess.prepare2(&h2c.client.trans, query)
+	st, err := h2c.client.prepareAll(sql)
 	if err != nil {
 		return nil, err
 	}
-	st, _ := stmt.(h2stmt)
-	nUpdated, err := h2c.client.sess.executeQueryUpdate(&st, &h2c.client.trans, argsValues)
+	argsValues, err := st.bindValues(args)
+	if err != nil {
+		h2c.client.closeCommand(st.id)
+		return nil, err
+	}
+	nUpdated, err := h2c.client.executeUpdate(&st, argsValues)
+	errClose := h2c.client.closeCommand(st.id)
 	if err != nil {
 		return nil, err
 	}
+	if errClose != nil {
+		return nil, errClose
+	}
 	return &h2ExecResult{nUpdated: nUpdated}, nil
 }
 
 // Specific code
 
-func connect(ci h2connInfo) (driver.Conn, error) {
-	var conn net.Conn
-	var err error
-	address := fmt.Sprintf("%s:%d", ci.host, ci.port)
-	conn, err = ci.dialer.Dial("tcp", address)
+func connect(ctx context.Context, cfg *Config, st *stats) (driver.Conn, error) {
+	if cfg.Cluster {
+		return connectCluster(ctx, cfg, st)
+	}
+	servers := cfg.servers()
+	var errs []string
+	for _, server := range servers {
+		conn, err := connectTo(ctx, cfg, st, server)
+		if err == nil {
+			return conn, nil
+		}
+		st.add(statBadConns, 1)
+		if len(servers) == 1 {
+			return nil, err
+		}
+		newLogger(cfg).L(LogWarn, "Can't connect to %s: %s", server, err)
+		errs = append(errs, server+": "+err.Error())
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Errorf("can't connect to any H2 server: %s", strings.Join(errs, "; "))
+}
+
+// connectTo opens a connection to a server
+func connectTo(ctx context.Context, cfg *Config, st *stats, server string) (*h2Conn, error) {
+	conn, err := dial(ctx, cfg, server)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to open H2 connection")
 	}
+	conn = &statsConn{Conn: conn, stats: st}
 	t := newTransfer(conn)
-	c := h2client{conn: conn, trans: t, sess: newSession()}
-	err = c.doHandshake(ci)
+	t.stats = st
+	t.enumOrdinals = cfg.EnumOrdinals
+	t.civil = cfg.Civil
+	t.streamLobs = cfg.StreamLobs
+	t.loc = cfg.Loc
+	t.logger = newLogger(cfg)
+	c := h2client{conn: conn, trans: t, sess: newSession(), hook: cfg.Hook, server: server}
+	err = c.doHandshake(cfg)
 	if err != nil {
+		conn.Close()
 		return nil, errors.Wrapf(err, "error doing H2 server handshake")
 	}
-	// ci.client = c
-	return &h2Conn{connInfo: ci, client: c}, nil
+	if cfg.SyncTimeZone {
+		err = c.setTimeZone(t.location())
+		if err != nil {
+			c.close()
+			return nil, errors.Wrapf(err, "can't set session time zone")
+		}
+	}
+	t.L(LogInfo, "Connected to %s", server)
+	return &h2Conn{cfg: cfg, client: &c}, nil
 }
@@ -0,0 +1,265 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// checkNamedValue normalizes an argument into a type known by the encoder
+func checkNamedValue(nv *driver.NamedValue) error {
+	v, err := convertValue(nv.Value)
+	if err != nil {
+		return errors.Wrapf(err, "can't convert parameter %d", nv.Ordinal)
+	}
+	nv.Value = v
+	return nil
+}
+
+func convertValue(v interface{}) (driver.Value, error) {
+	switch v := v.(type) {
+	case nil, bool, string, []byte, time.Time, *big.Int,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return v, nil
+	case Decimal, *big.Rat, UUID, json.RawMessage, time.Duration, Interval, Geometry, JavaObject,
+		Date, TimeOfDay, LocalDateTime:
+		return v, nil
+	case JSON:
+		return v.marshal()
+	case driver.Valuer:
+		return callValuer(v)
+	case *Lob, io.Reader:
+		// Streamed as LOB
+		return v, nil
+	case big.Int:
+		return &v, nil
+	case big.Rat:
+		return &v, nil
+	case []interface{}:
+		return convertSlice(reflect.ValueOf(v))
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return convertValue(rv.Elem().Interface())
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes(), nil
+		}
+		return convertSlice(rv)
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(data), rv)
+			return data, nil
+		}
+		return convertSlice(rv)
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Map, reflect.Struct:
+		// No SQL mapping but JSON, only for parameters declared JSON (see coerce)
+		return v, nil
+	}
+	return nil, errors.Errorf("unsupported type %T", v)
+}
+
+// isComposite tells if a value is a map or struct with no SQL mapping
+func isComposite(v driver.Value) bool {
+	if v == nil {
+		return false
+	}
+	switch v.(type) {
+	case time.Time, Decimal, Interval, Date, TimeOfDay, LocalDateTime:
+		return false
+	}
+	kind := reflect.TypeOf(v).Kind()
+	return kind == reflect.Map || kind == reflect.Struct
+}
+
+// callValuer gets the value of a Valuer, which can return any type known by the driver
+func callValuer(vr driver.Valuer) (driver.Value, error) {
+	rv := reflect.ValueOf(vr)
+	// Same as database/sql: nil pointers with value receivers are NULL
+	if rv.Kind() == reflect.Ptr && rv.IsNil() && rv.Type().Elem().Implements(valuerType) {
+		return nil, nil
+	}
+	v, err := vr.Value()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := v.(driver.Valuer); ok {
+		return nil, errors.Errorf("Valuer %T returned another Valuer %T", vr, v)
+	}
+	return convertValue(v)
+}
+
+// convertSlice converts a Go slice or array into an ARRAY value
+func convertSlice(rv reflect.Value) (driver.Value, error) {
+	if rv.Kind() == reflect.Slice && rv.IsNil() {
+		return nil, nil
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		v, err := convertValue(rv.Index(i).Interface())
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't convert array element %d", i)
+		}
+		list[i] = v
+	}
+	return list, nil
+}
+
+// coerce converts a value into the Go type matching the parameter type declared by the server
+func (p h2parameter) coerce(v driver.Value) (driver.Value, error) {
+	if isComposite(v) && p.kind != typeJSON {
+		return nil, errors.Errorf("unsupported type %T", v)
+	}
+	switch p.kind {
+	case ValueByte:
+		return coerceInteger(v, math.MinInt8, math.MaxInt8, "TINYINT", func(n int64) driver.Value { return int8(n) })
+	case ValueShort:
+		return coerceInteger(v, math.MinInt16, math.MaxInt16, "SMALLINT", func(n int64) driver.Value { return int16(n) })
+	case ValueInt:
+		return coerceInteger(v, math.MinInt32, math.MaxInt32, "INT", func(n int64) driver.Value { return int32(n) })
+	case ValueLong:
+		return coerceInteger(v, math.MinInt64, math.MaxInt64, "BIGINT", func(n int64) driver.Value { return n })
+	case ValueDouble:
+		switch x := v.(type) {
+		case float32:
+			return float64(x), nil
+		}
+		if n, ok, err := integerValue(v); ok && err == nil {
+			return float64(n), nil
+		}
+	case ValueFloat:
+		switch x := v.(type) {
+		case float64:
+			return float32(x), nil
+		}
+		if n, ok, err := integerValue(v); ok && err == nil {
+			return float32(n), nil
+		}
+	case ValueDecimal:
+		switch x := v.(type) {
+		case *big.Rat:
+			// Rounded as the server does with the declared scale
+			return roundRat(x, p.scale)
+		}
+	case ValueString, ValueStringIgnoreCase, ValueStringFixed, ValueClob, ValueEnum:
+		switch x := v.(type) {
+		case []byte:
+			return string(x), nil
+		}
+	case ValueUUID:
+		switch x := v.(type) {
+		case []byte:
+			// From [16]byte arrays
+			if len(x) == 16 {
+				var u UUID
+				copy(u[:], x)
+				return u, nil
+			}
+		case string:
+			return ParseUUID(x)
+		}
+	case typeJSON:
+		return toJSON(v)
+	case ValueBytes, ValueBlob, ValueJavaObject:
+		switch x := v.(type) {
+		case string:
+			return []byte(x), nil
+		}
+	}
+	return v, nil
+}
+
+// isText gets if the parameter is declared as character string, to send readers as CLOB
+func (p h2parameter) isText() bool {
+	switch p.kind {
+	case ValueString, ValueStringIgnoreCase, ValueStringFixed, ValueClob:
+		return true
+	}
+	return false
+}
+
+func coerceInteger(v driver.Value, min int64, max int64, typeName string, conv func(int64) driver.Value) (driver.Value, error) {
+	n, ok, err := integerValue(v)
+	if !ok {
+		// Non integer values are converted by the server
+		return v, nil
+	}
+	if err != nil || n < min || n > max {
+		return nil, errors.Errorf("value %v overflows %s", v, typeName)
+	}
+	return conv(n), nil
+}
+
+// integerValue returns the value of any Go integer as int64
+func integerValue(v driver.Value) (int64, bool, error) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), true, nil
+	case int8:
+		return int64(x), true, nil
+	case int16:
+		return int64(x), true, nil
+	case int32:
+		return int64(x), true, nil
+	case int64:
+		return x, true, nil
+	case time.Duration:
+		// Nanoseconds when declared as a number
+		return int64(x), true, nil
+	case uint:
+		return integerValue(uint64(x))
+	case uint8:
+		return int64(x), true, nil
+	case uint16:
+		return int64(x), true, nil
+	case uint32:
+		return int64(x), true, nil
+	case uint64:
+		if x > math.MaxInt64 {
+			return 0, true, errors.Errorf("value %d overflows int64", x)
+		}
+		return int64(x), true, nil
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"database/sql/driver"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Decimal is an exact decimal number (DECIMAL/NUMERIC) with value unscaled * 10^-scale
+type Decimal struct {
+	unscaled *big.Int
+	scale    int32
+}
+
+var bigTen = big.NewInt(10)
+
+// NewDecimal creates a decimal with value unscaled * 10^-scale
+func NewDecimal(unscaled *big.Int, scale int32) Decimal {
+	return Decimal{unscaled: new(big.Int).Set(unscaled), scale: scale}
+}
+
+// ParseDecimal parses a decimal in plain (123.45) or scientific (1.2345E+2) notation
+func ParseDecimal(s string) (Decimal, error) {
+	var d Decimal
+	text := strings.TrimSpace(s)
+	var exp int64
+	if pos := strings.IndexAny(text, "eE"); pos >= 0 {
+		var err error
+		exp, err = strconv.ParseInt(text[pos+1:], 10, 32)
+		if err != nil {
+			return d, errors.Errorf("invalid decimal exponent: %s", s)
+		}
+		text = text[:pos]
+	}
+	digits := text
+	var scale int64
+	if pos := strings.IndexByte(text, '.'); pos >= 0 {
+		digits = text[:pos] + text[pos+1:]
+		scale = int64(len(text) - pos - 1)
+	}
+	unscaled, ok := new(big.Int).SetString(digits, 10)
+	if !ok || strings.ContainsAny(digits[1:], "+-") {
+		return d, errors.Errorf("invalid decimal: %s", s)
+	}
+	scale -= exp
+	if scale != int64(int32(scale)) {
+		return d, errors.Errorf("decimal scale out of range: %s", s)
+	}
+	return Decimal{unscaled: unscaled, scale: int32(scale)}, nil
+}
+
+// Unscaled gets the unscaled value
+func (d Decimal) Unscaled() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(d.unscaled)
+}
+
+// Scale gets the number of digits after the decimal point
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// Rat gets the exact value as a rational number
+func (d Decimal) Rat() *big.Rat {
+	r := new(big.Rat).SetInt(d.Unscaled())
+	pow := new(big.Int).Exp(bigTen, big.NewInt(int64(abs32(d.scale))), nil)
+	if d.scale > 0 {
+		return r.Quo(r, new(big.Rat).SetInt(pow))
+	}
+	return r.Mul(r, new(big.Rat).SetInt(pow))
+}
+
+// Float64 gets the nearest float64 value
+func (d Decimal) Float64() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+// String gets the decimal in plain notation
+func (d Decimal) String() string {
+	unscaled := d.Unscaled()
+	if d.scale <= 0 {
+		pow := new(big.Int).Exp(bigTen, big.NewInt(int64(-d.scale)), nil)
+		return unscaled.Mul(unscaled, pow).String()
+	}
+	digits := new(big.Int).Abs(unscaled).String()
+	scale := int(d.scale)
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	sign := ""
+	if unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+// Scan implements sql.Scanner
+func (d *Decimal) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case string:
+		*d, err = ParseDecimal(v)
+	case []byte:
+		*d, err = ParseDecimal(string(v))
+	case int64:
+		*d = Decimal{unscaled: big.NewInt(v)}
+	case float64:
+		*d, err = ParseDecimal(strconv.FormatFloat(v, 'g', -1, 64))
+	case nil:
+		return errors.Errorf("can't scan NULL into Decimal")
+	default:
+		return errors.Errorf("can't scan %T into Decimal", src)
+	}
+	return err
+}
+
+// Value implements driver.Valuer
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// ratToDecimal converts a rational number to an exact decimal if it has a finite decimal expansion
+func ratToDecimal(r *big.Rat) (Decimal, error) {
+	denom := new(big.Int).Set(r.Denom())
+	var scale int
+	for _, factor := range []int64{2, 5} {
+		n := 0
+		f := big.NewInt(factor)
+		mod := new(big.Int)
+		for {
+			q, m := new(big.Int).QuoRem(denom, f, mod)
+			if m.Sign() != 0 {
+				break
+			}
+			denom = q
+			n++
+		}
+		if n > scale {
+			scale = n
+		}
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		return Decimal{}, errors.Errorf("%s has no exact decimal representation", r.String())
+	}
+	return ParseDecimal(r.FloatString(scale))
+}
+
+// roundRat rounds a rational number to a decimal with the given scale
+func roundRat(r *big.Rat, scale int32) (Decimal, error) {
+	if scale < 0 {
+		return ratToDecimal(r)
+	}
+	return ParseDecimal(r.FloatString(int(scale)))
+}
+
+func abs32(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DialContextFunc opens a connection to a server address (host:port), as through a tunnel or proxy
+type DialContextFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+var (
+	dialsLock sync.RWMutex
+	dials     = map[string]DialContextFunc{}
+)
+
+// RegisterDialContext registers a dial function, used by the connections with its name as Net
+// (net=<name> in the connection string)
+func RegisterDialContext(name string, dial DialContextFunc) {
+	dialsLock.Lock()
+	defer dialsLock.Unlock()
+	dials[name] = dial
+}
+
+// DeregisterDialContext removes a dial function
+func DeregisterDialContext(name string) {
+	dialsLock.Lock()
+	defer dialsLock.Unlock()
+	delete(dials, name)
+}
+
+// Helpers
+
+// dialer gets the dialer of a configuration: its Dialer, the function registered as its Net or a TCP dialer
+func (cfg *Config) dialer() (Dialer, error) {
+	if cfg.Dialer != nil {
+		return cfg.Dialer, nil
+	}
+	if cfg.Net != "" && cfg.Net != "tcp" {
+		dialsLock.RLock()
+		dial, ok := dials[cfg.Net]
+		dialsLock.RUnlock()
+		if !ok {
+			return nil, errors.Errorf("unknown dial function: %s", cfg.Net)
+		}
+		return dialFunc(dial), nil
+	}
+	return &net.Dialer{KeepAlive: cfg.KeepAlive}, nil
+}
+
+// dialFunc adapts a registered dial function to Dialer
+type dialFunc DialContextFunc
+
+func (f dialFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, address)
+}
+
+// dial opens the network connection to a server, with TLS and timeouts if configured
+func dial(ctx context.Context, cfg *Config, addr string) (net.Conn, error) {
+	dialer, err := cfg.dialer()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.DialTimeout)
+		defer cancel()
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		err = setTCPOptions(tcpConn, cfg)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if cfg.ReadTimeout > 0 || cfg.WriteTimeout > 0 {
+		conn = &timeoutConn{Conn: conn, readTimeout: cfg.ReadTimeout, writeTimeout: cfg.WriteTimeout}
+	}
+	if cfg.TLSConfig == nil {
+		return conn, nil
+	}
+	tlsConfig := cfg.TLSConfig
+	if tlsConfig.ServerName == "" && !tlsConfig.InsecureSkipVerify {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+		defer tlsConn.SetDeadline(time.Time{})
+	}
+	err = tlsConn.Handshake()
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "TLS handshake failed")
+	}
+	return tlsConn, nil
+}
+
+// setTCPOptions sets keep-alive and no delay on a TCP connection
+func setTCPOptions(conn *net.TCPConn, cfg *Config) error {
+	err := conn.SetNoDelay(!cfg.DisableNoDelay)
+	if err != nil {
+		return errors.Wrapf(err, "can't set TCP no delay")
+	}
+	if cfg.KeepAlive < 0 {
+		err = conn.SetKeepAlive(false)
+	} else if cfg.KeepAlive > 0 {
+		err = conn.SetKeepAlive(true)
+		if err == nil {
+			err = conn.SetKeepAlivePeriod(cfg.KeepAlive)
+		}
+	}
+	return errors.Wrapf(err, "can't set TCP keep-alive")
+}
+
+// timeoutConn sets a deadline before each read and write
+type timeoutConn struct {
+	net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func (c *timeoutConn) Read(b []byte) (int, error) {
+	if c.readTimeout > 0 {
+		err := c.Conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *timeoutConn) Write(b []byte) (int, error) {
+	if c.writeTimeout > 0 {
+		err := c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(b)
+}
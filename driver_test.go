@@ -17,12 +17,24 @@ limitations under the License.
 package h2go
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"math"
+	"math/big"
 	"net"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -260,6 +272,56 @@ func TestCRUDwithParameters(t *testing.T) {
 	})
 }
 
+// failingWriter fails all the writes, as a broken connection
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("broken pipe")
+}
+
+func TestWriteValue(t *testing.T) {
+	var buf bytes.Buffer
+	tr := transfer{buff: bufio.NewReadWriter(bufio.NewReader(&buf), bufio.NewWriter(&buf))}
+	values := []interface{}{int16(-7), uint64(math.MaxUint64), float32(1.5), ""}
+	for _, v := range values {
+		err := tr.writeValue(v)
+		if err != nil {
+			t.Fatalf("Can't write %T: %s", v, err)
+		}
+	}
+	tr.buff.Flush()
+	// SMALLINT as 32 bits integer
+	kind, _ := tr.readInt32()
+	n, err := tr.readInt32()
+	if err != nil || kind != ValueShort || n != -7 {
+		t.Errorf("Short mismatch: %d %d", kind, n)
+	}
+	// Over BIGINT as DECIMAL text
+	kind, _ = tr.readInt32()
+	text, err := tr.readString()
+	if err != nil || kind != ValueDecimal || text != "18446744073709551615" {
+		t.Errorf("Unsigned mismatch: %d %s", kind, text)
+	}
+	kind, _ = tr.readInt32()
+	f, err := tr.readFloat32()
+	if err != nil || kind != ValueFloat || f != 1.5 {
+		t.Errorf("Float mismatch: %d %f", kind, f)
+	}
+	// Empty string with length 0: -1 is a NULL string
+	kind, _ = tr.readInt32()
+	n, err = tr.readInt32()
+	if err != nil || kind != ValueString || n != 0 {
+		t.Errorf("Empty string mismatch: %d %d", kind, n)
+	}
+	// Write errors returned, not ignored
+	broken := transfer{buff: bufio.NewReadWriter(nil, bufio.NewWriterSize(failingWriter{}, 1))}
+	for _, v := range values {
+		if err = broken.writeValue(v); err == nil {
+			t.Errorf("Write error of %T not returned", v)
+		}
+	}
+}
+
 func TestDateTimeTypes(t *testing.T) {
 	runTests(t, func(dt *dbTest) {
 		var err error
@@ -406,6 +468,42 @@ func TestStmt(t *testing.T) {
 	})
 }
 
+func TestManyRows(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		// More rows than a fetch, and than the former 200 rows limit
+		rows, err := dt.conn.Query("SELECT X FROM SYSTEM_RANGE(1, 500)")
+		if err != nil {
+			dt.Fatalf("Can't query: %s", err)
+		}
+		defer rows.Close()
+		count := 0
+		for rows.Next() {
+			var x int
+			err = rows.Scan(&x)
+			dt.checkErr(err)
+			count++
+			if x != count {
+				dt.Errorf("Row mismatch: %d != %d", x, count)
+			}
+		}
+		dt.checkErr(rows.Err())
+		if count != 500 {
+			dt.Errorf("Num rows mismatch: %d != 500", count)
+		}
+		// Closed before reading all the rows
+		rows, err = dt.conn.Query("SELECT X FROM SYSTEM_RANGE(1, 500)")
+		dt.checkErr(err)
+		rows.Next()
+		dt.checkErr(rows.Close())
+		var n int
+		err = dt.conn.QueryRow("SELECT COUNT(*) FROM SYSTEM_RANGE(1, 300)").Scan(&n)
+		dt.checkErr(err)
+		if n != 300 {
+			dt.Errorf("Count mismatch: %d != 300", n)
+		}
+	})
+}
+
 func TestTx(t *testing.T) {
 	runTests(t, func(dt *dbTest) {
 		var err error
@@ -474,3 +572,1720 @@ func TestTx(t *testing.T) {
 		rows.Close()
 	})
 }
+
+type testStatus string
+
+type testCelsius struct {
+	degrees int
+}
+
+func (c testCelsius) Value() (driver.Value, error) {
+	return int16(c.degrees), nil
+}
+
+func TestRichParameters(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		var sent string
+		// CREATE TABLE
+		sent = "CREATE TABLE test (id TINYINT, small SMALLINT, big BIGINT, huge DECIMAL(20), bin BINARY(16), status VARCHAR(10), temp SMALLINT)"
+		_, err = dt.conn.Exec(sent)
+		dt.checkErr(err)
+		// INSERT
+		var (
+			id     int8       = 1
+			small  uint8      = 200
+			big    uint32     = 4000000000
+			huge   uint64     = math.MaxUint64
+			bin    [16]byte   = [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+			status testStatus = "active"
+		)
+		sent = "INSERT INTO test VALUES (?, ?, ?, ?, ?, ?, ?)"
+		stmt, err := dt.conn.Prepare(sent)
+		dt.checkErr(err)
+		result, err := stmt.Exec(id, small, big, huge, bin, status, testCelsius{21})
+		dt.checkErr(err)
+		nR, err := result.RowsAffected()
+		dt.checkErr(err)
+		if nR != 1 {
+			dt.Errorf("Num rows inserted not equal to 1")
+		}
+		// Overflow is detected before sending
+		_, err = stmt.Exec(id, 70000, big, huge, bin, status, testCelsius{21})
+		if err == nil {
+			dt.Errorf("Overflow not detected for SMALLINT")
+		}
+		stmt.Close()
+		// Query
+		sent = "SELECT big, CAST(huge AS VARCHAR), bin, status, temp FROM test WHERE small = ?"
+		rows, err := dt.conn.Query(sent, small)
+		dt.checkErr(err)
+		nRows := 0
+		for rows.Next() {
+			var (
+				vBig    int64
+				vHuge   string
+				vBin    []byte
+				vStatus string
+				vTemp   int
+			)
+			err = rows.Scan(&vBig, &vHuge, &vBin, &vStatus, &vTemp)
+			dt.checkErr(err)
+			nRows++
+			if vBig != int64(big) {
+				dt.Errorf("Big mismatch: %d", vBig)
+			}
+			if vHuge != "18446744073709551615" {
+				dt.Errorf("Huge mismatch: %s", vHuge)
+			}
+			if !bytes.Equal(vBin, bin[:]) {
+				dt.Errorf("Binary mismatch: %v", vBin)
+			}
+			if vStatus != "active" {
+				dt.Errorf("Status mismatch: %s", vStatus)
+			}
+			if vTemp != 21 {
+				dt.Errorf("Temp mismatch: %d", vTemp)
+			}
+		}
+		rows.Close()
+		if nRows != 1 {
+			dt.Errorf("Num rows queried not equal to 1")
+		}
+	})
+}
+
+func TestParseNamedQuery(t *testing.T) {
+	cases := []struct {
+		query string
+		want  string
+		names []string
+	}{
+		{"SELECT * FROM test WHERE id = :id", "SELECT * FROM test WHERE id = ?1", []string{"id"}},
+		{"SELECT * FROM test WHERE id = @id OR parent = @id", "SELECT * FROM test WHERE id = ?1 OR parent = ?1", []string{"id"}},
+		{"UPDATE test SET name = :name WHERE id = :id AND name <> :name", "UPDATE test SET name = ?1 WHERE id = ?2 AND name <> ?1", []string{"name", "id"}},
+		{"SELECT ':id', \"@col\", x::int FROM test -- :nope\nWHERE id = :id /* @nope */", "SELECT ':id', \"@col\", x::int FROM test -- :nope\nWHERE id = ?1 /* @nope */", []string{"id"}},
+		{"SELECT 'it''s :quoted' FROM test WHERE id = :id", "SELECT 'it''s :quoted' FROM test WHERE id = ?1", []string{"id"}},
+	}
+	for _, c := range cases {
+		nq, err := parseNamedQuery(c.query)
+		if err != nil {
+			t.Errorf("Can't parse %q: %s", c.query, err)
+			continue
+		}
+		if nq.query != c.want {
+			t.Errorf("Query mismatch: %q != %q", nq.query, c.want)
+		}
+		if fmt.Sprint(nq.names) != fmt.Sprint(c.names) {
+			t.Errorf("Names mismatch: %v != %v", nq.names, c.names)
+		}
+	}
+	// Binding errors
+	nq, _ := parseNamedQuery("SELECT * FROM test WHERE id = :id AND name = :name")
+	if _, err := nq.bind([]driver.NamedValue{{Name: "id", Ordinal: 1, Value: 1}}); err == nil {
+		t.Errorf("Missing named argument not detected")
+	}
+	if _, err := nq.bind([]driver.NamedValue{{Name: "id", Ordinal: 1, Value: 1}, {Name: "name", Ordinal: 2, Value: "Paco"}, {Name: "age", Ordinal: 3, Value: 23}}); err == nil {
+		t.Errorf("Unused named argument not detected")
+	}
+	bound, err := nq.bind([]driver.NamedValue{{Name: "name", Ordinal: 1, Value: "Paco"}, {Name: "id", Ordinal: 2, Value: 1}})
+	if err != nil {
+		t.Errorf("Can't bind named arguments: %s", err)
+	} else if bound[0].Value != 1 || bound[1].Value != "Paco" {
+		t.Errorf("Bound arguments mismatch: %v", bound)
+	}
+	// H2 user variables are kept without named arguments
+	query, _, err := rewriteNamed("SELECT @counter", nil)
+	if err != nil || query != "SELECT @counter" {
+		t.Errorf("User variable rewritten: %q (%v)", query, err)
+	}
+}
+
+func TestNamedParameters(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		var sent string
+		// CREATE TABLE
+		sent = "CREATE TABLE test (id INT, name VARCHAR(100), parent INT)"
+		_, err = dt.conn.Exec(sent)
+		dt.checkErr(err)
+		// INSERT
+		sent = "INSERT INTO test VALUES (:id, :name, :id)"
+		_, err = dt.conn.Exec(sent, sql.Named("name", "Paco"), sql.Named("id", 1))
+		dt.checkErr(err)
+		// Prepared statement
+		stmt, err := dt.conn.Prepare("INSERT INTO test VALUES (@id, @name, @parent)")
+		dt.checkErr(err)
+		_, err = stmt.Exec(sql.Named("id", 2), sql.Named("name", "John"), sql.Named("parent", 1))
+		dt.checkErr(err)
+		// Missing argument
+		_, err = stmt.Exec(sql.Named("id", 3), sql.Named("name", "Anne"))
+		if err == nil {
+			dt.Errorf("Missing named argument not detected")
+		}
+		// The rewritten statement is reused
+		_, err = stmt.Exec(sql.Named("id", 3), sql.Named("name", "Anne"), sql.Named("parent", 2))
+		dt.checkErr(err)
+		stmt.Close()
+		// Query
+		var name string
+		sent = "SELECT name FROM test WHERE parent = :parent AND id <> :parent"
+		err = dt.conn.QueryRow(sent, sql.Named("parent", 1)).Scan(&name)
+		dt.checkErr(err)
+		if name != "John" {
+			dt.Errorf("Name mismatch (not equal to 'John')")
+		}
+		// H2 user variables in prepared statements
+		ctx := context.Background()
+		conn, err := dt.conn.Conn(ctx)
+		dt.checkErr(err)
+		defer conn.Close()
+		_, err = conn.ExecContext(ctx, "SET @v = 5")
+		dt.checkErr(err)
+		stmt, err = conn.PrepareContext(ctx, "SELECT @v")
+		dt.checkErr(err)
+		var v int
+		err = stmt.QueryRow().Scan(&v)
+		dt.checkErr(err)
+		if v != 5 {
+			dt.Errorf("User variable mismatch: %d != 5", v)
+		}
+		stmt.Close()
+	})
+}
+
+func TestParseDecimal(t *testing.T) {
+	cases := map[string]string{
+		"123.4500":   "123.4500",
+		"-0.05":      "-0.05",
+		"1.2345E+2":  "123.45",
+		"1E+3":       "1000",
+		"-12E-5":     "-0.00012",
+		"+7":         "7",
+		"0.00000000": "0.00000000",
+	}
+	for text, want := range cases {
+		d, err := ParseDecimal(text)
+		if err != nil {
+			t.Errorf("Can't parse %s: %s", text, err)
+			continue
+		}
+		if d.String() != want {
+			t.Errorf("Decimal mismatch: %s != %s", d.String(), want)
+		}
+	}
+	for _, text := range []string{"", "1.2.3", "abc", "1-2", "1E"} {
+		if _, err := ParseDecimal(text); err == nil {
+			t.Errorf("Invalid decimal parsed: %q", text)
+		}
+	}
+	d, err := ratToDecimal(big.NewRat(1, 8))
+	if err != nil || d.String() != "0.125" {
+		t.Errorf("Rat conversion mismatch: %s (%v)", d, err)
+	}
+	if _, err = ratToDecimal(big.NewRat(1, 3)); err == nil {
+		t.Errorf("Inexact rat conversion not detected")
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		var sent string
+		// CREATE TABLE
+		sent = "CREATE TABLE test (id INT, amount DECIMAL(19,4))"
+		_, err = dt.conn.Exec(sent)
+		dt.checkErr(err)
+		// INSERT
+		amount, err := ParseDecimal("123456789012345.6789")
+		dt.checkErr(err)
+		sent = "INSERT INTO test VALUES (?, ?)"
+		_, err = dt.conn.Exec(sent, 1, amount)
+		dt.checkErr(err)
+		_, err = dt.conn.Exec(sent, 2, big.NewRat(1, 3))
+		dt.checkErr(err)
+		// Query
+		var (
+			vAmount Decimal
+			vText   string
+			vFloat  float64
+		)
+		sent = "SELECT amount, amount, amount FROM test WHERE id = ?"
+		err = dt.conn.QueryRow(sent, 1).Scan(&vAmount, &vText, &vFloat)
+		dt.checkErr(err)
+		if vAmount.String() != "123456789012345.6789" || vAmount.Scale() != 4 {
+			dt.Errorf("Amount mismatch: %s", vAmount)
+		}
+		if vText != "123456789012345.6789" {
+			dt.Errorf("Amount text mismatch: %s", vText)
+		}
+		if vFloat != 123456789012345.6789 {
+			dt.Errorf("Amount float mismatch: %f", vFloat)
+		}
+		err = dt.conn.QueryRow(sent, 2).Scan(&vAmount, &vText, &vFloat)
+		dt.checkErr(err)
+		if vText != "0.3333" {
+			dt.Errorf("Rounded amount mismatch: %s", vText)
+		}
+	})
+}
+
+func TestParseUUID(t *testing.T) {
+	text := "123e4567-e89b-12d3-a456-426614174000"
+	u, err := ParseUUID(text)
+	if err != nil {
+		t.Fatalf("Can't parse UUID: %s", err)
+	}
+	if u.String() != text {
+		t.Errorf("UUID mismatch: %s != %s", u, text)
+	}
+	high, low := u.halves()
+	if uuidFromHalves(high, low) != u {
+		t.Errorf("UUID halves mismatch: %x %x", high, low)
+	}
+	if _, err = ParseUUID("123e4567-e89b"); err == nil {
+		t.Errorf("Invalid UUID parsed")
+	}
+}
+
+func TestUUIDScan(t *testing.T) {
+	id, err := ParseUUID("123e4567-e89b-12d3-a456-426614174000")
+	if err != nil {
+		t.Fatalf("Can't parse UUID: %s", err)
+	}
+	// 16 raw bytes
+	var u UUID
+	err = u.Scan(id[:])
+	if err != nil || u != id {
+		t.Errorf("UUID from bytes mismatch: %s (%v)", u, err)
+	}
+	value, err := u.Value()
+	if err != nil || value != id.String() {
+		t.Errorf("UUID value mismatch: %v", value)
+	}
+	// Text as read from the server
+	var text UUID
+	err = text.Scan(value)
+	if err != nil || text != id {
+		t.Errorf("UUID from text mismatch: %s (%v)", text, err)
+	}
+	if err = u.Scan(nil); err == nil {
+		t.Errorf("NULL scanned into UUID")
+	}
+}
+
+func TestUUID(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		var sent string
+		// CREATE TABLE
+		sent = "CREATE TABLE test (id UUID PRIMARY KEY, name VARCHAR(100))"
+		_, err = dt.conn.Exec(sent)
+		dt.checkErr(err)
+		// INSERT
+		id, err := ParseUUID("123e4567-e89b-12d3-a456-426614174000")
+		dt.checkErr(err)
+		sent = "INSERT INTO test VALUES (?, ?)"
+		_, err = dt.conn.Exec(sent, id, "Paco")
+		dt.checkErr(err)
+		_, err = dt.conn.Exec(sent, [16]byte{15: 1}, "John")
+		dt.checkErr(err)
+		_, err = dt.conn.Exec(sent, "00000000-0000-0000-0000-000000000002", "Anne")
+		dt.checkErr(err)
+		// Query
+		var (
+			vID   UUID
+			vText string
+			vRaw  []byte
+		)
+		sent = "SELECT id, id, id FROM test WHERE name = ?"
+		err = dt.conn.QueryRow(sent, "Paco").Scan(&vID, &vText, &vRaw)
+		dt.checkErr(err)
+		if vID != id {
+			dt.Errorf("UUID mismatch: %s", vID)
+		}
+		if vText != id.String() || string(vRaw) != id.String() {
+			dt.Errorf("UUID text mismatch: %s - %s", vText, vRaw)
+		}
+		err = dt.conn.QueryRow(sent, "John").Scan(&vID, &vText, &vRaw)
+		dt.checkErr(err)
+		if vText != "00000000-0000-0000-0000-000000000001" {
+			dt.Errorf("UUID from array mismatch: %s", vText)
+		}
+		err = dt.conn.QueryRow("SELECT name FROM test WHERE id = ?", "00000000-0000-0000-0000-000000000002").Scan(&vText)
+		dt.checkErr(err)
+		if vText != "Anne" {
+			dt.Errorf("Name mismatch (not equal to 'Anne')")
+		}
+	})
+}
+
+func TestJSONParameters(t *testing.T) {
+	payload := map[string]interface{}{"kind": "created"}
+	v, err := convertValue(payload)
+	if err != nil {
+		t.Fatalf("Can't convert map: %s", err)
+	}
+	data, err := h2parameter{kind: typeJSON}.coerce(v)
+	if raw, ok := data.(json.RawMessage); err != nil || !ok || string(raw) != `{"kind":"created"}` {
+		t.Errorf("Map not marshalled for a JSON parameter: %v (%v)", data, err)
+	}
+	for _, kind := range []int32{ValueString, ValueInt} {
+		if _, err := (h2parameter{kind: kind}).coerce(v); err == nil {
+			t.Errorf("Map accepted for a parameter of type %d", kind)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		var sent string
+		type event struct {
+			Kind  string `json:"kind"`
+			Count int    `json:"count"`
+		}
+		// CREATE TABLE
+		sent = "CREATE TABLE test (id INT, payload JSON)"
+		_, err = dt.conn.Exec(sent)
+		dt.checkErr(err)
+		// INSERT
+		sent = "INSERT INTO test VALUES (?, ?)"
+		_, err = dt.conn.Exec(sent, 1, json.RawMessage(`{"kind":"created","count":1}`))
+		dt.checkErr(err)
+		_, err = dt.conn.Exec(sent, 2, event{Kind: "updated", Count: 2})
+		dt.checkErr(err)
+		_, err = dt.conn.Exec(sent, 3, map[string]interface{}{"kind": "deleted", "count": 3})
+		dt.checkErr(err)
+		// Only sent as JSON to JSON parameters
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (?, NULL)", event{Kind: "wrong"})
+		if err == nil {
+			dt.Errorf("Struct sent to an INT parameter")
+		}
+		// Query
+		rows, err := dt.conn.Query("SELECT id, payload, payload FROM test ORDER BY id")
+		dt.checkErr(err)
+		kinds := []string{"created", "updated", "deleted"}
+		for rows.Next() {
+			var (
+				id  int
+				raw json.RawMessage
+				ev  event
+			)
+			err = rows.Scan(&id, &raw, JSON{V: &ev})
+			dt.checkErr(err)
+			if !json.Valid(raw) {
+				dt.Errorf("Invalid JSON: %s", raw)
+			}
+			if ev.Kind != kinds[id-1] || ev.Count != id {
+				dt.Errorf("Event mismatch: %v", ev)
+			}
+		}
+		rows.Close()
+	})
+}
+
+func TestArrayScan(t *testing.T) {
+	src := []interface{}{int32(1), int64(2), int16(3)}
+	var ints Int64Array
+	err := ints.Scan(src)
+	if err != nil || fmt.Sprint(ints) != "[1 2 3]" {
+		t.Errorf("Int64Array mismatch: %v (%v)", ints, err)
+	}
+	var strs StringArray
+	err = strs.Scan([]interface{}{"a", nil, "c"})
+	if err == nil {
+		t.Errorf("NULL element stored into string")
+	}
+	var ptrs []*string
+	err = Array{V: &ptrs}.Scan([]interface{}{"a", nil, "c"})
+	if err != nil || len(ptrs) != 3 || ptrs[1] != nil || *ptrs[2] != "c" {
+		t.Errorf("Pointer array mismatch: %v (%v)", ptrs, err)
+	}
+	var nested [][]int
+	err = Array{V: &nested}.Scan([]interface{}{[]interface{}{int32(1)}, []interface{}{int32(2), int32(3)}})
+	if err != nil || fmt.Sprint(nested) != "[[1] [2 3]]" {
+		t.Errorf("Nested array mismatch: %v (%v)", nested, err)
+	}
+	var small []int8
+	err = Array{V: &small}.Scan([]interface{}{int32(1000)})
+	if err == nil {
+		t.Errorf("Overflow not detected")
+	}
+}
+
+func TestArray(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		var sent string
+		// CREATE TABLE
+		sent = "CREATE TABLE test (id INT, tags ARRAY, scores ARRAY)"
+		_, err = dt.conn.Exec(sent)
+		dt.checkErr(err)
+		// INSERT
+		sent = "INSERT INTO test VALUES (?, ?, ?)"
+		_, err = dt.conn.Exec(sent, 1, []string{"red", "green"}, Int64Array{10, 20})
+		dt.checkErr(err)
+		_, err = dt.conn.Exec(sent, 2, StringArray{"blue"}, []int{30})
+		dt.checkErr(err)
+		_, err = dt.conn.Exec(sent, 3, nil, nil)
+		dt.checkErr(err)
+		// Query
+		var (
+			tags   StringArray
+			scores []int
+			raw    interface{}
+		)
+		sent = "SELECT tags, scores, tags FROM test WHERE id = ?"
+		err = dt.conn.QueryRow(sent, 1).Scan(&tags, Array{V: &scores}, &raw)
+		dt.checkErr(err)
+		if fmt.Sprint(tags) != "[red green]" || fmt.Sprint(scores) != "[10 20]" {
+			dt.Errorf("Array mismatch: %v - %v", tags, scores)
+		}
+		if list, ok := raw.([]interface{}); !ok || len(list) != 2 {
+			dt.Errorf("Raw array mismatch: %v", raw)
+		}
+		err = dt.conn.QueryRow(sent, 3).Scan(&tags, Array{V: &scores}, &raw)
+		dt.checkErr(err)
+		if tags != nil || scores != nil || raw != nil {
+			dt.Errorf("NULL array mismatch: %v - %v - %v", tags, scores, raw)
+		}
+		// ANY filter
+		var n int
+		err = dt.conn.QueryRow("SELECT COUNT(*) FROM test WHERE id = ANY(?)", []int64{1, 2}).Scan(&n)
+		dt.checkErr(err)
+		if n != 2 {
+			dt.Errorf("Num rows filtered not equal to 2")
+		}
+	})
+}
+
+func TestRowAndResultSet(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		// ROW value
+		var row Row
+		err = dt.conn.QueryRow("SELECT (1, 'Paco')").Scan(&row)
+		dt.checkErr(err)
+		if len(row.Values) != 2 || row.Names[1] != "C2" {
+			dt.Errorf("Row mismatch: %v", row)
+		}
+		if name, ok := row.Get("C2"); !ok || name != "Paco" {
+			dt.Errorf("Row field mismatch: %v", name)
+		}
+		// Function returning a result set
+		_, err = dt.conn.Exec(`CREATE ALIAS test_rs AS 'ResultSet q(Connection c) throws SQLException {
+			return c.createStatement().executeQuery("SELECT X AS id FROM SYSTEM_RANGE(1, 3)"); }'`)
+		dt.checkErr(err)
+		defer dt.conn.Exec("DROP ALIAS IF EXISTS test_rs")
+		var rs interface{}
+		err = dt.conn.QueryRow("SELECT test_rs()").Scan(&rs)
+		dt.checkErr(err)
+		nested, ok := rs.(*ResultSet)
+		if !ok {
+			dt.Fatalf("Result set mismatch: %T", rs)
+		}
+		if nested.Len() != 3 || nested.Columns()[0] != "ID" {
+			dt.Errorf("Result set mismatch: %v - %v", nested.Columns(), nested.Values())
+		}
+		dest := make([]driver.Value, 1)
+		for i := 1; nested.Next(dest) == nil; i++ {
+			if fmt.Sprint(dest[0]) != strconv.Itoa(i) {
+				dt.Errorf("Result set row mismatch: %v", dest[0])
+			}
+		}
+	})
+}
+
+func TestParseEnumValues(t *testing.T) {
+	cases := map[string][]string{
+		"ENUM('PENDING','ACTIVE')":  {"PENDING", "ACTIVE"},
+		"enum('a', 'it''s', 'b,c')": {"a", "it's", "b,c"},
+		"ENUM":                      nil,
+		"VARCHAR":                   nil,
+	}
+	for typeName, expected := range cases {
+		values := parseEnumValues(typeName)
+		if fmt.Sprint(values) != fmt.Sprint(expected) || len(values) != len(expected) {
+			t.Errorf("Enum values mismatch for %s: %q", typeName, values)
+		}
+	}
+}
+
+func TestEnumScan(t *testing.T) {
+	var buf bytes.Buffer
+	tr := transfer{buff: bufio.NewReadWriter(bufio.NewReader(&buf), bufio.NewWriter(&buf))}
+	for i := 0; i < 2; i++ {
+		tr.writeInt32(ValueEnum)
+		tr.writeInt32(1)
+		tr.writeString("ACTIVE")
+	}
+	tr.buff.Flush()
+	// The label by default
+	v, err := tr.readValue()
+	if err != nil || v != "ACTIVE" {
+		t.Errorf("Enum label mismatch: %v (%v)", v, err)
+	}
+	// Label and ordinal with enumordinals
+	tr.enumOrdinals = true
+	v, err = tr.readValue()
+	if err != nil || v != (Enum{Label: "ACTIVE", Ordinal: 1}) {
+		t.Errorf("Enum mismatch: %v (%v)", v, err)
+	}
+	var e Enum
+	err = e.Scan(v)
+	if err != nil || e.Label != "ACTIVE" || e.Ordinal != 1 {
+		t.Errorf("Enum scan mismatch: %+v (%v)", e, err)
+	}
+	err = e.Scan("PENDING")
+	if err != nil || e.Label != "PENDING" || e.Ordinal != -1 {
+		t.Errorf("Enum label scan mismatch: %+v (%v)", e, err)
+	}
+	if value, _ := e.Value(); value != "PENDING" {
+		t.Errorf("Enum value mismatch: %v", value)
+	}
+	if err = e.Scan(nil); err == nil {
+		t.Errorf("NULL scanned into Enum")
+	}
+}
+
+func TestEnum(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		_, err = dt.conn.Exec("CREATE TABLE test (id INT PRIMARY KEY, status ENUM('PENDING', 'ACTIVE'))")
+		dt.checkErr(err)
+		// More rows than a fetch
+		for i := 0; i < 100; i++ {
+			status := "PENDING"
+			if i%2 == 1 {
+				status = "ACTIVE"
+			}
+			_, err = dt.conn.Exec("INSERT INTO test VALUES (?, ?)", i, status)
+			dt.checkErr(err)
+		}
+		_, err = dt.conn.Exec("UPDATE test SET status = ? WHERE id = 0", Enum{Label: "PENDING"})
+		dt.checkErr(err)
+		rows, err := dt.conn.Query("SELECT * FROM test ORDER BY id")
+		dt.checkErr(err)
+		defer rows.Close()
+		types, err := rows.ColumnTypes()
+		dt.checkErr(err)
+		if types[1].DatabaseTypeName() != "ENUM" {
+			dt.Errorf("Enum type mismatch: %s", types[1].DatabaseTypeName())
+		}
+		// Looked up while the rows are read
+		values, err := EnumValues(context.Background(), dt.conn, "TEST", "STATUS")
+		dt.checkErr(err)
+		if fmt.Sprint(values) != "[PENDING ACTIVE]" {
+			dt.Errorf("Enum values mismatch: %q", values)
+		}
+		n := 0
+		for rows.Next() {
+			var id int
+			var status string
+			err = rows.Scan(&id, &status)
+			dt.checkErr(err)
+			if status != values[id%2] {
+				dt.Errorf("Enum value mismatch: %d - %s", id, status)
+			}
+			n++
+		}
+		dt.checkErr(rows.Err())
+		if n != 100 {
+			dt.Errorf("Num rows %d not equal to 100", n)
+		}
+		if _, err = EnumValues(context.Background(), dt.conn, "TEST", "ID"); err == nil {
+			dt.Errorf("Enum values of INT column")
+		}
+	})
+}
+
+func TestNewInterval(t *testing.T) {
+	cases := []struct {
+		qualifier int8
+		negative  bool
+		leading   int64
+		remaining int64
+		expected  interface{}
+	}{
+		{intervalYear, false, 2, 0, Interval{Years: 2}},
+		{intervalMonth, true, 25, 0, Interval{Months: -25}},
+		{intervalYearToMonth, true, 1, 6, Interval{Years: -1, Months: -6}},
+		{intervalDay, false, 3, 0, 72 * time.Hour},
+		{intervalSecond, true, 1, 500000000, -1500 * time.Millisecond},
+		{intervalDayToMinute, false, 1, 90, 25*time.Hour + 30*time.Minute},
+		{intervalMinuteToSecond, false, 2, 5000000000, 2*time.Minute + 5*time.Second},
+	}
+	for _, c := range cases {
+		v, err := newInterval(c.qualifier, c.negative, c.leading, c.remaining)
+		if err != nil {
+			t.Errorf("Can't build interval %d: %s", c.qualifier, err)
+		} else if v != c.expected {
+			t.Errorf("Interval %d mismatch: %v != %v", c.qualifier, v, c.expected)
+		}
+	}
+	_, err := newInterval(intervalDay, false, 200000, 0)
+	if err == nil {
+		t.Errorf("Interval overflow not detected")
+	}
+	if s := (Interval{Years: -1, Months: -6}).String(); s != "-1-6" {
+		t.Errorf("Interval text mismatch: %s", s)
+	}
+}
+
+func TestInterval(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		_, err = dt.conn.Exec("CREATE TABLE test (id INT PRIMARY KEY, backoff INTERVAL MINUTE TO SECOND, period INTERVAL YEAR TO MONTH)")
+		dt.checkErr(err)
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (?, ?, ?)", 1, 90*time.Second, Interval{Years: 1, Months: 2})
+		dt.checkErr(err)
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (2, INTERVAL '-0:30' MINUTE TO SECOND, INTERVAL '-2' YEAR)")
+		dt.checkErr(err)
+		sent := "SELECT backoff, period FROM test WHERE id = ?"
+		var backoff time.Duration
+		var period Interval
+		err = dt.conn.QueryRow(sent, 1).Scan(&backoff, &period)
+		dt.checkErr(err)
+		if backoff != 90*time.Second || period.TotalMonths() != 14 {
+			dt.Errorf("Interval mismatch: %v - %v", backoff, period)
+		}
+		err = dt.conn.QueryRow(sent, 2).Scan(&backoff, &period)
+		dt.checkErr(err)
+		if backoff != -30*time.Second || period.TotalMonths() != -24 {
+			dt.Errorf("Negative interval mismatch: %v - %v", backoff, period)
+		}
+		err = dt.conn.QueryRow("SELECT INTERVAL '1 02:03:04.5' DAY TO SECOND").Scan(&backoff)
+		dt.checkErr(err)
+		if backoff != 26*time.Hour+3*time.Minute+4500*time.Millisecond {
+			dt.Errorf("Day to second interval mismatch: %v", backoff)
+		}
+	})
+}
+
+func TestStatementClose(t *testing.T) {
+	var buf bytes.Buffer
+	c := &h2client{trans: transfer{buff: bufio.NewReadWriter(bufio.NewReader(&buf), bufio.NewWriter(&buf))}, sess: newSession()}
+	named := &h2stmt{id: 7, client: c}
+	st := h2stmt{id: 3, client: c, atNames: &namedStmt{stmt: named}}
+	err := st.Close()
+	if err == nil {
+		err = c.trans.flush()
+	}
+	if err != nil {
+		t.Fatalf("Can't close statement: %s", err)
+	}
+	var sent []int32
+	for i := 0; i < 4; i++ {
+		v, err := c.trans.readInt32()
+		if err != nil {
+			t.Fatalf("Can't read command: %s", err)
+		}
+		sent = append(sent, v)
+	}
+	if sent[0] != sessionCommandClose || sent[1] != 7 || sent[2] != sessionCommandClose || sent[3] != 3 {
+		t.Errorf("Close commands mismatch: %v", sent)
+	}
+}
+
+func TestDateTimeLocation(t *testing.T) {
+	var buf bytes.Buffer
+	tr := transfer{buff: bufio.NewReadWriter(bufio.NewReader(&buf), bufio.NewWriter(&buf))}
+	midnight := time.Date(2020, 5, 25, 0, 0, 0, 0, time.FixedZone("UTC+2", 7200))
+	roundTrip := func(write func(time.Time) error, read func() (time.Time, error)) time.Time {
+		err := write(midnight)
+		if err == nil {
+			err = tr.flush()
+		}
+		if err == nil {
+			_, err = tr.readInt32()
+		}
+		var v time.Time
+		if err == nil {
+			v, err = read()
+		}
+		if err != nil {
+			t.Fatalf("Can't write and read %v: %s", midnight, err)
+		}
+		return v
+	}
+	// DATE keeps its wall date, with or without loc
+	for _, loc := range []*time.Location{nil, time.UTC} {
+		tr.loc = loc
+		if d := roundTrip(tr.writeDateValue, tr.readDate); d.Day() != 25 {
+			t.Errorf("Date mismatch with loc %v: %v", loc, d)
+		}
+	}
+	// TIMESTAMP keeps its wall clock without loc, and is converted to loc
+	tr.loc = nil
+	if ts := roundTrip(tr.writeTimestampValue, tr.readTimestamp); ts.Day() != 25 || ts.Hour() != 0 {
+		t.Errorf("Timestamp mismatch without loc: %v", ts)
+	}
+	tr.loc = time.UTC
+	if ts := roundTrip(tr.writeTimestampValue, tr.readTimestamp); !ts.Equal(midnight) || ts.Hour() != 22 {
+		t.Errorf("Timestamp mismatch with loc: %v", ts)
+	}
+}
+
+func TestLobChars(t *testing.T) {
+	text := "Año 2020: 日本 \U0001F600"
+	var buf bytes.Buffer
+	n, err := writeChars(&buf, strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("Can't write chars: %s", err)
+	}
+	if n != utf16Len(text) || n != 15 {
+		t.Errorf("Num chars mismatch: %d", n)
+	}
+	s, err := readChars(&buf, n)
+	if err != nil || s != text {
+		t.Errorf("Chars mismatch: %q - %v", s, err)
+	}
+	// Lengths of readers with and without size
+	for _, r := range []io.Reader{strings.NewReader(text), io.MultiReader(strings.NewReader(text))} {
+		src, err := newLobSource(r, true)
+		if err != nil {
+			t.Fatalf("Can't get LOB source: %s", err)
+		}
+		data, _ := ioutil.ReadAll(src.r)
+		src.cleanup()
+		if src.length != 15 || string(data) != text {
+			t.Errorf("LOB source mismatch: %d - %q", src.length, data)
+		}
+	}
+}
+
+func TestLobClosedRows(t *testing.T) {
+	lob := &Lob{kind: ValueBlob, precision: 10, res: &h2Result{closed: true}}
+	if _, err := lob.Read(make([]byte, 4)); err == nil || !strings.Contains(err.Error(), "rows are closed") {
+		t.Errorf("LOB read after closing its rows: %v", err)
+	}
+	var scanned Lob
+	if err := scanned.Scan([]byte("in memory")); err != nil {
+		t.Fatalf("Can't scan bytes into Lob: %s", err)
+	}
+	if data, err := ioutil.ReadAll(&scanned); err != nil || string(data) != "in memory" {
+		t.Errorf("Scanned LOB mismatch: %s (%v)", data, err)
+	}
+}
+
+func TestLob(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		_, err = dt.conn.Exec("CREATE TABLE test (id INT PRIMARY KEY, doc BLOB, notes CLOB)")
+		dt.checkErr(err)
+		small := []byte("small attachment")
+		big := bytes.Repeat([]byte("0123456789abcdef"), 256*1024)
+		text := strings.Repeat("Año ", 512*1024)
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (?, ?, ?)", 1, small, "short notes")
+		dt.checkErr(err)
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (?, ?, ?)", 2, bytes.NewReader(big), io.MultiReader(strings.NewReader(text)))
+		dt.checkErr(err)
+		sent := "SELECT doc, notes FROM test WHERE id = ?"
+		var doc []byte
+		var notes string
+		err = dt.conn.QueryRow(sent, 1).Scan(&doc, &notes)
+		dt.checkErr(err)
+		if !bytes.Equal(doc, small) || notes != "short notes" {
+			dt.Errorf("Small LOB mismatch: %s - %s", doc, notes)
+		}
+		// Big LOBs are read into memory too
+		err = dt.conn.QueryRow(sent, 2).Scan(&doc, &notes)
+		dt.checkErr(err)
+		if !bytes.Equal(doc, big) || notes != text {
+			dt.Errorf("Big LOB mismatch: %d bytes - %d bytes", len(doc), len(notes))
+		}
+		// Streamed while the rows are open
+		streamDB, err := sql.Open("h2", dsn+"&streamlobs=true")
+		dt.checkErr(err)
+		defer streamDB.Close()
+		rows, err := streamDB.Query(sent, 2)
+		if err != nil {
+			dt.Fatalf("Can't query LOBs: %s", err)
+		}
+		var bigDoc, bigNotes Lob
+		if !rows.Next() {
+			dt.Fatalf("LOB row not found: %v", rows.Err())
+		}
+		err = rows.Scan(&bigDoc, &bigNotes)
+		dt.checkErr(err)
+		if bigDoc.Size() != int64(len(big)) || !bigNotes.IsClob() {
+			dt.Errorf("LOB size mismatch: %d", bigDoc.Size())
+		}
+		data, err := ioutil.ReadAll(&bigDoc)
+		dt.checkErr(err)
+		if !bytes.Equal(data, big) {
+			dt.Errorf("BLOB content mismatch: %d bytes", len(data))
+		}
+		part := make([]byte, 4)
+		_, err = bigDoc.ReadAt(part, 16)
+		dt.checkErr(err)
+		if string(part) != "0123" {
+			dt.Errorf("BLOB part mismatch: %s", part)
+		}
+		data, err = bigNotes.Bytes()
+		dt.checkErr(err)
+		if string(data) != text {
+			dt.Errorf("CLOB content mismatch: %d bytes", len(data))
+		}
+		rows.Close()
+		if _, err = bigDoc.ReadAt(part, 0); err == nil {
+			dt.Errorf("LOB read after closing its rows")
+		}
+		// Written back by reference
+		_, err = streamDB.Exec("INSERT INTO test VALUES (?, ?, ?)", 3, &bigDoc, &bigNotes)
+		dt.checkErr(err)
+		var n int
+		err = dt.conn.QueryRow("SELECT LENGTH(doc) FROM test WHERE id = 3").Scan(&n)
+		dt.checkErr(err)
+		if n != len(big) {
+			dt.Errorf("Copied LOB length %d not equal to %d", n, len(big))
+		}
+	})
+}
+
+func TestGeometryWKT(t *testing.T) {
+	cases := []string{
+		"POINT (1 2)",
+		"POINT Z (1 2 3)",
+		"POINT EMPTY",
+		"LINESTRING (0 0, 1.5 1, 2 -3)",
+		"POLYGON ((0 0, 4 0, 4 4, 0 0), (1 1, 2 1, 1 2, 1 1))",
+		"MULTIPOINT ((1 2), (3 4))",
+		"MULTILINESTRING ((0 0, 1 1), (2 2, 3 3))",
+		"MULTIPOLYGON (((0 0, 1 0, 1 1, 0 0)), ((5 5, 6 5, 6 6, 5 5)))",
+		"GEOMETRYCOLLECTION (POINT (1 2), LINESTRING (0 0, 1 1))",
+		"MULTIPOINT EMPTY",
+	}
+	for _, wkt := range cases {
+		g, err := ParseWKT(wkt)
+		if err != nil {
+			t.Errorf("Can't parse %s: %s", wkt, err)
+			continue
+		}
+		text, err := g.WKT()
+		if err != nil || text != wkt {
+			t.Errorf("WKT mismatch: %s != %s (%v)", text, wkt, err)
+		}
+	}
+	g, err := ParseWKT("SRID=4326;multipoint (1 2, 3 4)")
+	if err != nil {
+		t.Fatalf("Can't parse EWKT: %s", err)
+	}
+	if g.SRID() != 4326 || g.String() != "SRID=4326;MULTIPOINT ((1 2), (3 4))" {
+		t.Errorf("EWKT mismatch: %s", g)
+	}
+	// Little endian WKB
+	data, _ := hex.DecodeString("0101000000000000000000F03F0000000000000040")
+	if text, err := Geometry(data).WKT(); err != nil || text != "POINT (1 2)" {
+		t.Errorf("WKB mismatch: %s (%v)", text, err)
+	}
+	for _, wkt := range []string{"POINT (1)", "LINESTRING (0 0, 1 1 1)", "CIRCLE (1 2)", "POINT (1 2))"} {
+		if _, err := ParseWKT(wkt); err == nil {
+			t.Errorf("Invalid WKT not detected: %s", wkt)
+		}
+	}
+}
+
+func TestGeometry(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		_, err = dt.conn.Exec("CREATE TABLE test (id INT PRIMARY KEY, location GEOMETRY)")
+		dt.checkErr(err)
+		point, err := ParseWKT("SRID=4326;POINT (-3.7 40.4)")
+		dt.checkErr(err)
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (?, ?)", 1, point)
+		dt.checkErr(err)
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (2, 'POLYGON ((0 0, 1 0, 1 1, 0 0))')")
+		dt.checkErr(err)
+		var g Geometry
+		err = dt.conn.QueryRow("SELECT location FROM test WHERE id = 1").Scan(&g)
+		dt.checkErr(err)
+		if g.SRID() != 4326 || g.String() != "SRID=4326;POINT (-3.7 40.4)" {
+			dt.Errorf("Geometry mismatch: %s", g)
+		}
+		err = dt.conn.QueryRow("SELECT location FROM test WHERE id = 2").Scan(&g)
+		dt.checkErr(err)
+		if g.String() != "POLYGON ((0 0, 1 0, 1 1, 0 0))" {
+			dt.Errorf("Geometry mismatch: %s", g)
+		}
+		// Spatial filter
+		var n int
+		err = dt.conn.QueryRow("SELECT COUNT(*) FROM test WHERE location && ?", g).Scan(&n)
+		dt.checkErr(err)
+		if n != 1 {
+			dt.Errorf("Num geometries %d not equal to 1", n)
+		}
+	})
+}
+
+func TestJavaObjectDecode(t *testing.T) {
+	cases := map[string]interface{}{
+		// "hi"
+		"aced00057400026869": "hi",
+		// Integer.valueOf(42)
+		"aced0005737200116a6176612e6c616e672e496e746567657212e2a0a4f781873802000149000576616c7565" +
+			"787200106a6176612e6c616e672e4e756d62657286ac951d0b94e08b02000078700000002a": int32(42),
+		// Boolean.TRUE
+		"aced0005737200116a6176612e6c616e672e426f6f6c65616ecd207280d59cfaee0200015a000576616c7565787001": true,
+	}
+	for text, expected := range cases {
+		data, _ := hex.DecodeString(text)
+		v, err := JavaObject(data).Decode()
+		if err != nil || v != expected {
+			t.Errorf("Java object mismatch: %v != %v (%v)", v, expected, err)
+		}
+	}
+	if _, err := JavaObject([]byte{1, 2, 3}).Decode(); err == nil {
+		t.Errorf("Invalid Java object not detected")
+	}
+}
+
+func TestJavaObject(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		_, err = dt.conn.Exec("CREATE TABLE test (id INT PRIMARY KEY, data OTHER)")
+		dt.checkErr(err)
+		// Integer.valueOf(42)
+		data, _ := hex.DecodeString("aced0005737200116a6176612e6c616e672e496e746567657212e2a0a4f781873802000149000576616c7565" +
+			"787200106a6176612e6c616e672e4e756d62657286ac951d0b94e08b02000078700000002a")
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (?, ?)", 1, JavaObject(data))
+		dt.checkErr(err)
+		var obj JavaObject
+		err = dt.conn.QueryRow("SELECT data FROM test WHERE id = 1").Scan(&obj)
+		dt.checkErr(err)
+		// Written back unchanged
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (?, ?)", 2, obj)
+		dt.checkErr(err)
+		var raw []byte
+		err = dt.conn.QueryRow("SELECT data FROM test WHERE id = 2").Scan(&raw)
+		dt.checkErr(err)
+		if !bytes.Equal(raw, data) {
+			dt.Errorf("Java object mismatch: %x", raw)
+		}
+		if v, err := obj.Decode(); err != nil || v != int32(42) {
+			dt.Errorf("Java object value mismatch: %v (%v)", v, err)
+		}
+	})
+}
+
+func TestCivilTypes(t *testing.T) {
+	d, err := ParseDate("-0044-03-15")
+	if err != nil || d != (Date{Year: -44, Month: time.March, Day: 15}) || d.String() != "-0044-03-15" {
+		t.Errorf("Date mismatch: %v (%v)", d, err)
+	}
+	for _, date := range []Date{d, {Year: 12345, Month: 12, Day: 31}, {Year: 0, Month: 1, Day: 1}, {Year: 2020, Month: 2, Day: 29}} {
+		if v := dateFromValue(date.dateValue()); v != date {
+			t.Errorf("Date value mismatch: %v != %v", v, date)
+		}
+	}
+	if _, err := ParseDate("2021-02-29"); err == nil {
+		t.Errorf("Invalid date not detected")
+	}
+	tod, err := ParseTimeOfDay("07:30:15.25")
+	if err != nil || tod != (TimeOfDay{7, 30, 15, 250000000}) || tod.String() != "07:30:15.25" {
+		t.Errorf("Time of day mismatch: %v (%v)", tod, err)
+	}
+	if v := timeOfDayFromNanos(tod.nanos()); v != tod {
+		t.Errorf("Time of day nanos mismatch: %v", v)
+	}
+	dt, err := ParseLocalDateTime("10000-01-02T03:04:05")
+	if err != nil || dt.String() != "10000-01-02 03:04:05" {
+		t.Errorf("Local date time mismatch: %v (%v)", dt, err)
+	}
+	madrid := time.FixedZone("CET", 3600)
+	if v := dt.In(madrid); v.Year() != 10000 || v.Hour() != 3 {
+		t.Errorf("Local date time in location mismatch: %v", v)
+	}
+}
+
+func TestCivilTypesQuery(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		_, err = dt.conn.Exec("CREATE TABLE test (id INT PRIMARY KEY, birth DATE, shift TIME, hired TIMESTAMP)")
+		dt.checkErr(err)
+		birth := Date{Year: 1985, Month: time.October, Day: 27}
+		shift := TimeOfDay{Hour: 22, Minute: 30}
+		hired, _ := ParseLocalDateTime("2020-03-29 02:30:00")
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (?, ?, ?, ?)", 1, birth, shift, hired)
+		dt.checkErr(err)
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (2, DATE '-0100-01-01', TIME '00:00:01', TIMESTAMP '12000-06-01 12:00:00')")
+		dt.checkErr(err)
+		// Civil types returned on demand
+		civilDB, err := sql.Open("h2", dsn+"&civil=true")
+		if err != nil {
+			dt.Fatalf("Can't connect to the H2 server: %s", err)
+		}
+		defer civilDB.Close()
+		sent := "SELECT birth, shift, hired FROM test WHERE id = ?"
+		var vBirth, vShift, vHired interface{}
+		err = civilDB.QueryRow(sent, 1).Scan(&vBirth, &vShift, &vHired)
+		dt.checkErr(err)
+		if vBirth != birth || vShift != shift || vHired != hired {
+			dt.Errorf("Civil values mismatch: %v - %v - %v", vBirth, vShift, vHired)
+		}
+		var d Date
+		var tod TimeOfDay
+		var ldt LocalDateTime
+		err = civilDB.QueryRow(sent, 2).Scan(&d, &tod, &ldt)
+		dt.checkErr(err)
+		if d.String() != "-0100-01-01" || tod.String() != "00:00:01" || ldt.String() != "12000-06-01 12:00:00" {
+			dt.Errorf("Civil values mismatch: %v - %v - %v", d, tod, ldt)
+		}
+		// Also scanned from time.Time
+		err = dt.conn.QueryRow(sent, 1).Scan(&d, &tod, &ldt)
+		dt.checkErr(err)
+		if d != birth || tod != shift || ldt != hired {
+			dt.Errorf("Civil values from time mismatch: %v - %v - %v", d, tod, ldt)
+		}
+	})
+}
+
+func TestTimeZoneLocation(t *testing.T) {
+	if !available {
+		t.Skipf("H2 Server not running on %s", addr)
+	}
+	runTests(t, func(dt *dbTest) {
+		var err error
+		madrid, err := time.LoadLocation("Europe/Madrid")
+		if err != nil {
+			dt.Skipf("No time zone database: %s", err)
+		}
+		madridDB, err := sql.Open("h2", dsn+"&loc=Europe/Madrid&synctz=true")
+		if err != nil {
+			dt.Fatalf("Can't connect to the H2 server: %s", err)
+		}
+		defer madridDB.Close()
+		_, err = madridDB.Exec("CREATE TABLE test (id INT PRIMARY KEY, ts TIMESTAMP)")
+		dt.checkErr(err)
+		// Stored as Madrid wall clock
+		instant := time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC)
+		_, err = madridDB.Exec("INSERT INTO test VALUES (?, ?)", 1, instant)
+		dt.checkErr(err)
+		var text string
+		err = madridDB.QueryRow("SELECT CAST(ts AS VARCHAR) FROM test WHERE id = 1").Scan(&text)
+		dt.checkErr(err)
+		if text != "2020-07-01 12:00:00" {
+			dt.Errorf("Stored timestamp mismatch: %s", text)
+		}
+		var ts time.Time
+		err = madridDB.QueryRow("SELECT ts FROM test WHERE id = 1").Scan(&ts)
+		dt.checkErr(err)
+		if !ts.Equal(instant) || ts.Location() != madrid {
+			dt.Errorf("Timestamp mismatch: %v", ts)
+		}
+		// Session time zone
+		var hours int
+		err = madridDB.QueryRow("SELECT EXTRACT(TIMEZONE_HOUR FROM CURRENT_TIMESTAMP)").Scan(&hours)
+		dt.checkErr(err)
+		if _, offset := time.Now().In(madrid).Zone(); hours*3600 != offset {
+			dt.Errorf("Session time zone offset mismatch: %d", hours)
+		}
+	})
+}
+
+func TestNullParameterCheck(t *testing.T) {
+	st := h2stmt{parameters: []h2parameter{{kind: ValueInt, nullable: columnNoNulls}, {kind: ValueString, nullable: columnNullable}}}
+	nv := driver.NamedValue{Ordinal: 1}
+	err := st.CheckNamedValue(&nv)
+	if err == nil || !strings.Contains(err.Error(), "can't be NULL") {
+		t.Errorf("NULL for NOT NULL parameter not detected: %v", err)
+	}
+	nv = driver.NamedValue{Ordinal: 2}
+	if err = st.CheckNamedValue(&nv); err != nil {
+		t.Errorf("NULL for nullable parameter rejected: %s", err)
+	}
+	// Checked again when written
+	var buf bytes.Buffer
+	tr := transfer{buff: bufio.NewReadWriter(bufio.NewReader(&buf), bufio.NewWriter(&buf))}
+	s := newSession()
+	if err = s.writeParameter(&tr, nil, st.parameter(0)); err == nil {
+		t.Errorf("NULL written for NOT NULL parameter")
+	}
+	// Nullable and without metadata
+	for _, idx := range []int{1, 2} {
+		err = s.writeParameter(&tr, nil, st.parameter(idx))
+		if err != nil {
+			t.Fatalf("Can't write NULL parameter %d: %s", idx, err)
+		}
+	}
+	tr.buff.Flush()
+	for i := 0; i < 2; i++ {
+		if kind, err := tr.readInt32(); err != nil || kind != ValueNull {
+			t.Errorf("NULL mismatch: %d (%v)", kind, err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Unexpected data after NULLs: %d bytes", buf.Len())
+	}
+}
+
+func TestNullParameters(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		_, err = dt.conn.Exec("CREATE TABLE test (id INT NOT NULL, name VARCHAR(50), born DATE, salary DECIMAL(10, 2), active BOOLEAN)")
+		dt.checkErr(err)
+		// NULLs of any type, typed by the server from the columns
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (?, ?, ?, ?, ?)", 1, sql.NullString{}, sql.NullTime{}, nil, sql.NullBool{})
+		dt.checkErr(err)
+		_, err = dt.conn.Exec("MERGE INTO test KEY (id) VALUES (?, ?, ?, ?, ?)", 1, sql.NullString{String: "Paco", Valid: true}, nil, sql.NullFloat64{}, true)
+		dt.checkErr(err)
+		var n int
+		err = dt.conn.QueryRow("SELECT COUNT(*) FROM test WHERE name = 'Paco' AND born IS NULL AND salary IS NULL AND active").Scan(&n)
+		dt.checkErr(err)
+		if n != 1 {
+			dt.Errorf("Num rows %d not equal to 1", n)
+		}
+		// Nullability checked before sending the statement
+		_, err = dt.conn.Exec("INSERT INTO test (id, name) VALUES (?, ?)", sql.NullInt64{}, "Pepe")
+		if err == nil || !strings.Contains(err.Error(), "can't be NULL") {
+			dt.Errorf("NULL for NOT NULL column not detected: %v", err)
+		}
+		rows, err := dt.conn.Query("SELECT id, name FROM test")
+		dt.checkErr(err)
+		defer rows.Close()
+		types, err := rows.ColumnTypes()
+		dt.checkErr(err)
+		if nullable, ok := types[0].Nullable(); !ok || nullable {
+			dt.Errorf("ID column nullability mismatch")
+		}
+		if nullable, ok := types[1].Nullable(); !ok || !nullable {
+			dt.Errorf("Name column nullability mismatch")
+		}
+	})
+}
+
+func TestTimeParameterDefault(t *testing.T) {
+	runTests(t, func(dt *dbTest) {
+		var err error
+		_, err = dt.conn.Exec("CREATE TABLE test (id INT PRIMARY KEY, created TIMESTAMP WITH TIME ZONE)")
+		dt.checkErr(err)
+		now := time.Now().Truncate(time.Microsecond)
+		_, err = dt.conn.Exec("INSERT INTO test VALUES (1, ?), (2, ?)", now, now.Add(-48*time.Hour))
+		dt.checkErr(err)
+		// Parameter inside an expression
+		var n int
+		err = dt.conn.QueryRow("SELECT COUNT(*) FROM test WHERE created > ? - INTERVAL '1' DAY", now).Scan(&n)
+		dt.checkErr(err)
+		if n != 1 {
+			dt.Errorf("Num rows %d not equal to 1", n)
+		}
+		// Parameter without type keeps its offset
+		zone := time.FixedZone("UTC-3", -3*3600)
+		var v time.Time
+		err = dt.conn.QueryRow("SELECT ?", now.In(zone)).Scan(&v)
+		dt.checkErr(err)
+		if _, offset := v.Zone(); !v.Equal(now) || offset != -3*3600 {
+			dt.Errorf("Time parameter mismatch: %v", v)
+		}
+	})
+}
+
+func TestParseDSN(t *testing.T) {
+	cfg, err := ParseDSN("h2://sa:secret@h2server:9093/data/test?mem=true&timeout=5s&readTimeout=1m&tls=skip-verify&loc=UTC")
+	if err != nil {
+		t.Fatalf("Can't parse DSN: %s", err)
+	}
+	if cfg.Host != "h2server" || cfg.Port != 9093 || cfg.Database != "mem:data/test" ||
+		cfg.User != "sa" || cfg.Password != "secret" || cfg.DialTimeout != 5*time.Second ||
+		cfg.ReadTimeout != time.Minute || cfg.TLSConfig == nil || !cfg.TLSConfig.InsecureSkipVerify || cfg.Loc != time.UTC {
+		t.Errorf("DSN parsed wrong: %+v", cfg)
+	}
+	again, err := ParseDSN(cfg.FormatDSN())
+	if err != nil {
+		t.Fatalf("Can't parse formatted DSN %s: %s", cfg.FormatDSN(), err)
+	}
+	if again.FormatDSN() != cfg.FormatDSN() || again.Database != cfg.Database {
+		t.Errorf("DSN round trip mismatch: %s != %s", again.FormatDSN(), cfg.FormatDSN())
+	}
+	// The path is the database, with its leading slash
+	cfg, _ = ParseDSN("h2://localhost/test")
+	if cfg.Database != "/test" {
+		t.Errorf("Database path mismatch: %s", cfg.Database)
+	}
+	for _, database := range []string{"~/data/app", "./app", "app", "/var/h2/app", "mem:cache"} {
+		cfg := NewConfig()
+		cfg.Database = database
+		again, err := ParseDSN(cfg.FormatDSN())
+		if err != nil || again.Database != database {
+			t.Errorf("Database round trip mismatch: %s (%v)", cfg.FormatDSN(), err)
+		}
+	}
+	cfg, _ = ParseDSN("h2://localhost")
+	if cfg.Port != defaultH2port || cfg.Database != "~/test" || cfg.FormatDSN() != "h2://localhost:9092" {
+		t.Errorf("Defaults mismatch: %s", cfg.FormatDSN())
+	}
+	if _, err := ParseDSN("h2://localhost/test?timeout=never"); err == nil {
+		t.Errorf("Invalid timeout not detected")
+	}
+}
+
+func TestHandshakeDatabase(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	sent := make(chan []string, 1)
+	go func() {
+		defer server.Close()
+		st := newTransfer(server)
+		var values []string
+		st.readInt32()
+		st.readInt32()
+		for i := 0; i < 2; i++ {
+			value, _ := st.readString()
+			values = append(values, value)
+		}
+		sent <- values
+	}()
+	cfg, err := ParseDSN("h2://sa@localhost/test")
+	if err != nil {
+		t.Fatalf("Can't parse DSN: %s", err)
+	}
+	c := h2client{conn: client, trans: newTransfer(client), sess: newSession()}
+	c.doHandshake(cfg)
+	values := <-sent
+	if values[0] != "/test" || values[1] != "jdbc:h2:tcp://localhost:9092//test" {
+		t.Errorf("Handshake database mismatch: %v", values)
+	}
+}
+
+func TestParseJDBC(t *testing.T) {
+	cfg, err := ParseDSN("jdbc:h2:tcp://db:9093/~/data;MODE=MySQL;user=sa;PASSWORD=secret;IFEXISTS=TRUE")
+	if err != nil {
+		t.Fatalf("Can't parse JDBC URL: %s", err)
+	}
+	if cfg.Host != "db" || cfg.Port != 9093 || cfg.Database != "~/data" || cfg.User != "sa" || cfg.Password != "secret" ||
+		cfg.TLSConfig != nil || len(cfg.Properties) != 2 || cfg.Properties["MODE"] != "MySQL" || cfg.Properties["IFEXISTS"] != "TRUE" {
+		t.Errorf("JDBC URL parsed wrong: %+v", cfg)
+	}
+	if cfg.jdbcURL() != "jdbc:h2:tcp://db:9093/~/data;MODE=MySQL;user=sa;IFEXISTS=TRUE" {
+		t.Errorf("Original URL mismatch: %s", cfg.jdbcURL())
+	}
+	// Original URL of connection strings
+	for dsn, expected := range map[string]string{
+		"h2://sa@db:9093/test":                "jdbc:h2:tcp://db:9093//test",
+		"h2://sa@db?database=~/data&tls=true": "jdbc:h2:ssl://db:9092/~/data",
+		"h2://sa@db/test?mem=true":            "jdbc:h2:tcp://db:9092/mem:test",
+		"h2://sa@db/var/h2/test":              "jdbc:h2:tcp://db:9092//var/h2/test",
+		"h2://sa@[::1]:9093":                  "jdbc:h2:tcp://[::1]:9093/~/test",
+		"jdbc:h2:tcp://db/~/data;USER=sa":     "jdbc:h2:tcp://db/~/data;USER=sa",
+		"jdbc:h2:ssl://db:9093/mem:test;X=10": "jdbc:h2:ssl://db:9093/mem:test;X=10",
+	} {
+		cfg, err := ParseDSN(dsn)
+		if err != nil {
+			t.Errorf("Can't parse %s: %s", dsn, err)
+		} else if cfg.jdbcURL() != expected {
+			t.Errorf("Original URL of %s mismatch: %s != %s", dsn, cfg.jdbcURL(), expected)
+		}
+	}
+	cfg, err = ParseDSN("jdbc:h2:ssl://[::1]/mem:test")
+	if err != nil || cfg.Host != "::1" || cfg.Port != defaultH2port || cfg.Database != "mem:test" || cfg.TLSConfig == nil {
+		t.Errorf("JDBC URL parsed wrong: %+v (%v)", cfg, err)
+	}
+	for _, invalid := range []string{"jdbc:h2:mem:test", "jdbc:h2:~/test", "jdbc:h2:tcp://localhost", "jdbc:h2:tcp://localhost/test;MODE"} {
+		if _, err := ParseDSN(invalid); err == nil {
+			t.Errorf("Invalid JDBC URL not detected: %s", invalid)
+		}
+	}
+}
+
+type testLogger []string
+
+func (l *testLogger) Log(level LogLevel, msg string) {
+	*l = append(*l, level.String()+": "+msg)
+}
+
+func TestLogger(t *testing.T) {
+	cfg, err := ParseDSN("h2://sa:s3cret@localhost/test?logging=info")
+	if err != nil {
+		t.Fatalf("Can't parse DSN: %s", err)
+	}
+	if cfg.LogLevel != LogInfo || cfg.Logger == nil {
+		t.Errorf("Logging option not applied: %v", cfg.LogLevel)
+	}
+	var out testLogger
+	cfg.Logger = &out
+	l := newLogger(cfg)
+	l.L(LogDebug, "Hidden")
+	l.L(LogInfo, "Open with dsn: %s", "h2://sa:s3cret@localhost/test")
+	if len(out) != 1 || out[0] != "info: Open with dsn: h2://sa:xxxxx@localhost/test" {
+		t.Errorf("Logged messages mismatch: %q", out)
+	}
+	var none *logger
+	none.L(LogError, "Not logged")
+	for dsn, expected := range map[string]string{
+		"h2://sa:s3cret@localhost/test?mem=true":               "h2://sa:xxxxx@localhost/test?mem=true",
+		"h2://sa@localhost/test":                               "h2://sa@localhost/test",
+		"jdbc:h2:tcp://localhost/~/test;USER=sa;password=s3cr": "jdbc:h2:tcp://localhost/~/test;USER=sa;password=xxxxx",
+	} {
+		if redacted := redactDSN(dsn); redacted != expected {
+			t.Errorf("Redacted DSN mismatch: %s != %s", redacted, expected)
+		}
+	}
+	if _, err := ParseDSN("h2://localhost/test?logging=verbose"); err == nil {
+		t.Errorf("Invalid log level not detected")
+	}
+}
+
+func TestConnector(t *testing.T) {
+	if !available {
+		t.Skipf("H2 Server not running on %s", addr)
+	}
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("Can't parse DSN: %s", err)
+	}
+	cfg.Properties = map[string]string{"MODE": "MySQL"}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatalf("Can't create connector: %s", err)
+	}
+	conn := sql.OpenDB(connector)
+	defer conn.Close()
+	var mode string
+	err = conn.QueryRow("SELECT VALUE FROM INFORMATION_SCHEMA.SETTINGS WHERE NAME = 'MODE'").Scan(&mode)
+	if err != nil || mode != "MySQL" {
+		t.Errorf("Handshake properties not applied: %s (%v)", mode, err)
+	}
+}
+
+type ctxKey string
+
+type testHook struct {
+	events []HookEvent
+}
+
+func (h *testHook) Before(ctx context.Context, ev *HookEvent) context.Context {
+	return context.WithValue(ctx, ctxKey("op"), ev.Op)
+}
+
+func (h *testHook) After(ctx context.Context, ev *HookEvent) {
+	if ctx.Value(ctxKey("op")) == nil {
+		ev.Err = fmt.Errorf("context of Before not propagated")
+	}
+	h.events = append(h.events, *ev)
+}
+
+func TestHookCall(t *testing.T) {
+	hook := &testHook{}
+	hc := startHook(context.Background(), hook, OpExec, "DELETE FROM test", 2)
+	if hc.context(nil).Value(ctxKey("op")) != OpExec {
+		t.Errorf("Context of Before not kept")
+	}
+	hc.end(3, nil)
+	if len(hook.events) != 1 || hook.events[0].Op != OpExec || hook.events[0].Rows != 3 ||
+		hook.events[0].NumArgs != 2 || hook.events[0].Err != nil || hook.events[0].Duration < 0 {
+		t.Errorf("Hook event mismatch: %+v", hook.events)
+	}
+	// Without hook
+	hc = startHook(context.Background(), nil, OpExec, "DELETE FROM test", 0)
+	hc.end(0, nil)
+	if hc.context(context.TODO()) != context.TODO() {
+		t.Errorf("Context changed without hook")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	if !available {
+		t.Skipf("H2 Server not running on %s", addr)
+	}
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("Can't parse DSN: %s", err)
+	}
+	hook := &testHook{}
+	cfg.Hook = hook
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatalf("Can't create connector: %s", err)
+	}
+	conn := sql.OpenDB(connector)
+	defer conn.Close()
+	_, err = conn.Exec("CREATE TABLE test (id INT)")
+	if err != nil {
+		t.Fatalf("Can't create table: %s", err)
+	}
+	defer conn.Exec("DROP TABLE test")
+	tx, err := conn.Begin()
+	if err != nil {
+		t.Fatalf("Can't begin transaction: %s", err)
+	}
+	_, err = tx.Exec("INSERT INTO test SELECT X FROM SYSTEM_RANGE(1, 100)")
+	if err != nil {
+		t.Fatalf("Can't insert: %s", err)
+	}
+	tx.Commit()
+	rows, err := conn.Query("SELECT id FROM test WHERE id > ?", 0)
+	if err != nil {
+		t.Fatalf("Can't query: %s", err)
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	rows.Close()
+	ops := []HookOp{}
+	var fetched int64
+	for _, ev := range hook.events {
+		if ev.Err != nil {
+			t.Errorf("Hook error in %s: %s", ev.Op, ev.Err)
+		}
+		if ev.Op == OpQuery || ev.Op == OpFetch {
+			fetched += ev.Rows
+		}
+		if len(ops) == 0 || ops[len(ops)-1] != ev.Op {
+			ops = append(ops, ev.Op)
+		}
+	}
+	expected := []HookOp{OpExec, OpCommit, OpQuery, OpFetch}
+	if fmt.Sprint(ops) != fmt.Sprint(expected) || fetched != 100 || n != 100 {
+		t.Errorf("Hook events mismatch: %v (%d rows)", ops, fetched)
+	}
+}
+
+func TestStatsCounters(t *testing.T) {
+	before := TotalStats()
+	st := newStats()
+	st.command(sessionPrepareReadParams2)
+	st.command(sessionPrepareReadParams2)
+	st.add(statOpenStatements, 2)
+	st.add(statOpenStatements, -1)
+	st.add(statBytesIn, 100)
+	snapshot := st.snapshot()
+	if snapshot.Commands["prepareReadParams"] != 2 || snapshot.OpenStatements != 1 || snapshot.BytesIn != 100 || len(snapshot.Commands) != 1 {
+		t.Errorf("Stats mismatch: %+v", snapshot)
+	}
+	total := TotalStats()
+	if total.BytesIn-before.BytesIn < 100 || total.OpenStatements-before.OpenStatements < 1 {
+		t.Errorf("Total stats not updated: %+v", total)
+	}
+	if v := expvar.Get("h2go"); v == nil || !strings.Contains(v.String(), `"bytesIn"`) {
+		t.Errorf("Stats not published with expvar: %v", v)
+	}
+	var none *stats
+	none.add(statErrors, 1)
+}
+
+func TestStats(t *testing.T) {
+	if !available {
+		t.Skipf("H2 Server not running on %s", addr)
+	}
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("Can't parse DSN: %s", err)
+	}
+	connector, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatalf("Can't create connector: %s", err)
+	}
+	conn := sql.OpenDB(connector)
+	defer conn.Close()
+	_, err = conn.Exec("CREATE TABLE test (id INT)")
+	if err != nil {
+		t.Fatalf("Can't create table: %s", err)
+	}
+	defer conn.Exec("DROP TABLE test")
+	stmt, err := conn.Prepare("INSERT INTO test VALUES (?)")
+	if err != nil {
+		t.Fatalf("Can't prepare: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		stmt.Exec(i)
+	}
+	stmt.Close()
+	rows, err := conn.Query("SELECT id FROM test")
+	if err != nil {
+		t.Fatalf("Can't query: %s", err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+	conn.Exec("SELECT * FROM missing")
+	st := connector.Stats()
+	if st.OpenStatements != 0 || st.OpenResults != 0 || st.Errors != 1 || st.Commands["fetchRows"] != 1 ||
+		st.Commands["executeUpdate"] < 100 || st.BytesIn == 0 || st.BytesOut == 0 || st.RoundTrips == 0 {
+		t.Errorf("Stats mismatch: %+v", st)
+	}
+}
+
+func TestOpenStats(t *testing.T) {
+	dsn := "h2://sa@127.0.0.1:1/test?timeout=1s"
+	for i := 0; i < 2; i++ {
+		if _, err := (h2Driver{}).Open(dsn); err == nil {
+			t.Fatalf("Connected to a closed port")
+		}
+	}
+	h2c, err := (h2Driver{}).connector(dsn)
+	if err != nil {
+		t.Fatalf("Can't get connector: %s", err)
+	}
+	if st := h2c.Stats(); st.BadConns != 2 {
+		t.Errorf("Stats of Open not added up: %+v", st)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	var dialed string
+	errDial := fmt.Errorf("no tunnel")
+	RegisterDialContext("test", func(ctx context.Context, addr string) (net.Conn, error) {
+		dialed = addr
+		return nil, errDial
+	})
+	defer DeregisterDialContext("test")
+	cfg, err := ParseDSN("h2://sa@[::1]:9093/test?net=test&keepalive=30s&nodelay=false")
+	if err != nil {
+		t.Fatalf("Can't parse DSN: %s", err)
+	}
+	if cfg.Net != "test" || cfg.KeepAlive != 30*time.Second || !cfg.DisableNoDelay {
+		t.Errorf("Dial options parsed wrong: %+v", cfg)
+	}
+	if formatted, _ := ParseDSN(cfg.FormatDSN()); formatted.Net != "test" || formatted.KeepAlive != cfg.KeepAlive || !formatted.DisableNoDelay {
+		t.Errorf("Dial options lost in %s", cfg.FormatDSN())
+	}
+	connector, _ := NewConnector(cfg)
+	_, err = connector.Connect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), errDial.Error()) || dialed != "[::1]:9093" {
+		t.Errorf("Registered dial function not used: %s (%v)", dialed, err)
+	}
+	if connector.Stats().BadConns != 1 {
+		t.Errorf("Failed connection not counted: %+v", connector.Stats())
+	}
+	cfg.Net = "missing"
+	connector, _ = NewConnector(cfg)
+	_, err = connector.Connect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "unknown dial function") {
+		t.Errorf("Unknown dial function not detected: %v", err)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	var dialed []string
+	RegisterDialContext("failover", func(ctx context.Context, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return nil, fmt.Errorf("%s is down", addr)
+	})
+	defer DeregisterDialContext("failover")
+	cfg, err := ParseDSN("h2://sa:pass@db1:9093,db2,[::1]:9094/test?net=failover")
+	if err != nil {
+		t.Fatalf("Can't parse DSN: %s", err)
+	}
+	if cfg.Host != "db1" || cfg.Port != 9093 || len(cfg.Hosts) != 2 || cfg.User != "sa" || cfg.Database != "/test" {
+		t.Errorf("Hosts parsed wrong: %+v", cfg)
+	}
+	if again, _ := ParseDSN(cfg.FormatDSN()); again == nil || fmt.Sprint(again.Hosts) != fmt.Sprint(cfg.Hosts) {
+		t.Errorf("Hosts lost in %s", cfg.FormatDSN())
+	}
+	connector, _ := NewConnector(cfg)
+	_, err = connector.Connect(context.Background())
+	expected := []string{"db1:9093", "db2:9093", "[::1]:9094"}
+	if fmt.Sprint(dialed) != fmt.Sprint(expected) || err == nil || !strings.Contains(err.Error(), "db2:9093 is down") {
+		t.Errorf("Servers not tried in order: %v (%v)", dialed, err)
+	}
+	dialed = nil
+	cfg.RandomHosts = true
+	connector, _ = NewConnector(cfg)
+	connector.Connect(context.Background())
+	if len(dialed) != 3 {
+		t.Errorf("Servers not tried: %v", dialed)
+	}
+	if _, err := ParseDSN("h2://db1,db2:port/test"); err == nil {
+		t.Errorf("Invalid failover host not detected")
+	}
+}
+
+func TestCluster(t *testing.T) {
+	cfg, err := ParseDSN("jdbc:h2:tcp://node1:9101,node2/~/test;USER=sa")
+	if err != nil {
+		t.Fatalf("Can't parse JDBC URL: %s", err)
+	}
+	if !cfg.Cluster || cfg.Host != "node1" || cfg.Port != 9101 || fmt.Sprint(cfg.Hosts) != "[node2]" {
+		t.Errorf("Cluster URL parsed wrong: %+v", cfg)
+	}
+	if _, err := ParseDSN("jdbc:h2:tcp://node1,/~/test"); err == nil {
+		t.Errorf("Invalid cluster node not detected")
+	}
+	cfg, err = ParseDSN("h2://sa@node1,node2:9102/test?cluster=true&net=cluster")
+	if err != nil {
+		t.Fatalf("Can't parse DSN: %s", err)
+	}
+	if again, _ := ParseDSN(cfg.FormatDSN()); again == nil || !again.Cluster {
+		t.Errorf("Cluster option lost in %s", cfg.FormatDSN())
+	}
+	// All the nodes are dialed, not just the first one
+	var dialed []string
+	RegisterDialContext("cluster", func(ctx context.Context, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return nil, fmt.Errorf("%s is down", addr)
+	})
+	defer DeregisterDialContext("cluster")
+	connector, _ := NewConnector(cfg)
+	_, err = connector.Connect(context.Background())
+	if fmt.Sprint(dialed) != "[node1:9092 node2:9102]" || err == nil || !strings.Contains(err.Error(), "node2:9102: ") {
+		t.Errorf("Cluster nodes not dialed: %v (%v)", dialed, err)
+	}
+	// Streams are sent again to each node
+	stream := strings.NewReader("0123456789")
+	stream.Seek(2, io.SeekStart)
+	values := []driver.Value{int32(1), stream}
+	marks, err := markValues(values)
+	if err != nil {
+		t.Fatalf("Can't mark values: %s", err)
+	}
+	ioutil.ReadAll(stream)
+	if err = rewindValues(values, marks); err != nil || stream.Len() != 8 {
+		t.Errorf("Stream not rewound: %d (%v)", stream.Len(), err)
+	}
+	if _, err = markValues([]driver.Value{ioutil.NopCloser(stream)}); err == nil {
+		t.Errorf("Stream without Seek not detected")
+	}
+	// LOBs in memory can be sent again, stored ones are references to a node
+	if _, err = markValues([]driver.Value{&Lob{kind: ValueBlob, data: []byte("in memory")}}); err != nil {
+		t.Errorf("LOB in memory rejected: %s", err)
+	}
+	if _, err = markValues([]driver.Value{&Lob{kind: ValueBlob, lobID: 1}}); err == nil {
+		t.Errorf("Stored LOB not detected")
+	}
+	if !isSQLError(&h2error{}) || isSQLError(io.EOF) {
+		t.Errorf("SQL errors not told from connection errors")
+	}
+}
+
+func TestClusterNodeFailure(t *testing.T) {
+	// Nodes answering SET CLUSTER '' (a prepare and an update) and recording the commands sent
+	node := func() (transfer, *bytes.Buffer) {
+		var responses, sent bytes.Buffer
+		w := transfer{buff: bufio.NewReadWriter(nil, bufio.NewWriter(&responses))}
+		w.writeInt32(sessionStatusOk)
+		w.writeBool(false)
+		w.writeBool(false)
+		w.writeInt32(0)
+		w.writeInt32(0)
+		w.writeInt32(sessionStatusOk)
+		w.writeInt32(0)
+		w.writeBool(false)
+		w.flush()
+		return transfer{buff: bufio.NewReadWriter(bufio.NewReader(&responses), bufio.NewWriter(&sent))}, &sent
+	}
+	primary, _ := node()
+	trans, sent := node()
+	good := &clusterNode{server: "node3", trans: trans}
+	conn, _ := net.Pipe()
+	broken := transfer{buff: bufio.NewReadWriter(nil, bufio.NewWriterSize(failingWriter{}, 1))}
+	failed := &clusterNode{server: "node2", conn: conn, trans: broken}
+	c := &h2client{trans: primary, sess: newSession(), server: "node1", replicas: []*clusterNode{failed, good}, cluster: true}
+	err := c.closeCommand(5)
+	if err != nil {
+		t.Fatalf("Can't close command: %s", err)
+	}
+	if len(c.replicas) != 1 || c.replicas[0] != good {
+		t.Errorf("Failed node not dropped: %v", c.replicas)
+	}
+	// The nodes after the failed one got the command before the cluster was disabled
+	good.trans.flush()
+	r := transfer{buff: bufio.NewReadWriter(bufio.NewReader(sent), nil)}
+	cmd, _ := r.readInt32()
+	id, _ := r.readInt32()
+	next, _ := r.readInt32()
+	if cmd != sessionCommandClose || id != 5 || next != sessionPrepareReadParams2 {
+		t.Errorf("Command not sent to all the nodes before disabling the cluster: %d %d %d", cmd, id, next)
+	}
+}
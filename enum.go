@@ -0,0 +1,120 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Enum is a H2 ENUM value: its label and its ordinal, the index of the label in the values of the type.
+// ENUM columns are read as their labels, and as Enum with the enumordinals option.
+type Enum struct {
+	Label   string
+	Ordinal int
+}
+
+// String gets the label
+func (e Enum) String() string {
+	return e.Label
+}
+
+// Scan implements sql.Scanner. The ordinal of a label scanned without it is -1.
+func (e *Enum) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case Enum:
+		*e = v
+	case string:
+		*e = Enum{Label: v, Ordinal: -1}
+	case []byte:
+		*e = Enum{Label: string(v), Ordinal: -1}
+	case nil:
+		return errors.Errorf("can't scan NULL into Enum")
+	default:
+		return errors.Errorf("can't scan %T into Enum", src)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer
+func (e Enum) Value() (driver.Value, error) {
+	return e.Label, nil
+}
+
+// Querier runs a query that returns a row, as sql.DB, sql.Conn and sql.Tx
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// EnumValues gets the allowed values of an ENUM column from INFORMATION_SCHEMA. The ordinal of a
+// value is its index. The table is looked up in the current schema unless given as SCHEMA.TABLE,
+// and the names are the ones stored by H2: in upper case unless they were quoted.
+func EnumValues(ctx context.Context, q Querier, table string, column string) ([]string, error) {
+	query := "SELECT COLUMN_TYPE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = SCHEMA() AND TABLE_NAME = ? AND COLUMN_NAME = ?"
+	args := []interface{}{table, column}
+	if pos := strings.Index(table, "."); pos >= 0 {
+		query = "SELECT COLUMN_TYPE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND COLUMN_NAME = ?"
+		args = []interface{}{table[:pos], table[pos+1:], column}
+	}
+	var typeName string
+	err := q.QueryRowContext(ctx, query, args...).Scan(&typeName)
+	if err == sql.ErrNoRows {
+		return nil, errors.Errorf("column %s.%s not found", table, column)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get ENUM values of %s.%s", table, column)
+	}
+	values := parseEnumValues(typeName)
+	if values == nil {
+		return nil, errors.Errorf("column %s.%s isn't an ENUM: %s", table, column, typeName)
+	}
+	return values, nil
+}
+
+// Helpers
+
+// parseEnumValues gets the values of an ENUM type as ENUM('A','B')
+func parseEnumValues(typeName string) []string {
+	pos := strings.Index(strings.ToUpper(typeName), "ENUM(")
+	if pos < 0 {
+		return nil
+	}
+	var values []string
+	text := typeName[pos+5:]
+	for i := 0; i < len(text) && text[i] != ')'; i++ {
+		if text[i] != '\'' {
+			continue
+		}
+		var sb strings.Builder
+		for i++; i < len(text); i++ {
+			if text[i] == '\'' {
+				if i+1 < len(text) && text[i+1] == '\'' {
+					i++
+				} else {
+					break
+				}
+			}
+			sb.WriteByte(text[i])
+		}
+		values = append(values, sb.String())
+	}
+	return values
+}
@@ -0,0 +1,613 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Geometry types
+const (
+	geomPoint uint32 = iota + 1
+	geomLineString
+	geomPolygon
+	geomMultiPoint
+	geomMultiLineString
+	geomMultiPolygon
+	geomCollection
+)
+
+// EWKB type flags
+const (
+	ewkbZ    uint32 = 0x80000000
+	ewkbM    uint32 = 0x40000000
+	ewkbSRID uint32 = 0x20000000
+)
+
+var geomNames = map[uint32]string{
+	geomPoint:           "POINT",
+	geomLineString:      "LINESTRING",
+	geomPolygon:         "POLYGON",
+	geomMultiPoint:      "MULTIPOINT",
+	geomMultiLineString: "MULTILINESTRING",
+	geomMultiPolygon:    "MULTIPOLYGON",
+	geomCollection:      "GEOMETRYCOLLECTION",
+}
+
+// Geometry is a GEOMETRY value as EWKB (extended well-known binary, with optional SRID)
+type Geometry []byte
+
+// ParseWKT builds a geometry from its WKT (POINT (1 2)) or EWKT (SRID=4326;POINT (1 2)) representation
+func ParseWKT(wkt string) (Geometry, error) {
+	var srid int64
+	text := strings.TrimSpace(wkt)
+	if strings.HasPrefix(strings.ToUpper(text), "SRID=") {
+		pos := strings.IndexByte(text, ';')
+		if pos < 0 {
+			return nil, errors.Errorf("invalid EWKT: %s", wkt)
+		}
+		var err error
+		srid, err = strconv.ParseInt(strings.TrimSpace(text[5:pos]), 10, 32)
+		if err != nil {
+			return nil, errors.Errorf("invalid SRID: %s", wkt)
+		}
+		text = text[pos+1:]
+	}
+	p := &wktParser{tokens: tokenizeWKT(text)}
+	g, err := p.parseGeometry()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid WKT: %s", wkt)
+	}
+	if p.pos != len(p.tokens) {
+		return nil, errors.Errorf("invalid WKT: unexpected %s", p.tokens[p.pos])
+	}
+	// Without Z or M, dimensions are given by the coordinates
+	if !g.hasZ && !g.hasM {
+		g.hasZ = p.dims >= 3
+		g.hasM = p.dims == 4
+	}
+	g.setDims(g.hasZ, g.hasM)
+	w := &wkbWriter{}
+	w.writeGeometry(g, int32(srid), true)
+	return w.buf.Bytes(), nil
+}
+
+// SRID gets the spatial reference system identifier, 0 if the geometry hasn't one
+func (g Geometry) SRID() int32 {
+	r := &wkbReader{data: g}
+	_, srid, err := r.readHeader()
+	if err != nil {
+		return 0
+	}
+	return srid
+}
+
+// WKT gets the geometry as WKT, without the SRID
+func (g Geometry) WKT() (string, error) {
+	r := &wkbReader{data: g}
+	node, err := r.readGeometry()
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid EWKB")
+	}
+	var sb strings.Builder
+	node.writeWKT(&sb, true)
+	return sb.String(), nil
+}
+
+// String gets the geometry as EWKT
+func (g Geometry) String() string {
+	wkt, err := g.WKT()
+	if err != nil {
+		return "<invalid geometry>"
+	}
+	if srid := g.SRID(); srid != 0 {
+		return "SRID=" + strconv.Itoa(int(srid)) + ";" + wkt
+	}
+	return wkt
+}
+
+// Scan implements sql.Scanner
+func (g *Geometry) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case Geometry:
+		*g = v
+	case []byte:
+		*g = append(Geometry(nil), v...)
+	case string:
+		*g, err = ParseWKT(v)
+	case nil:
+		*g = nil
+	default:
+		return errors.Errorf("can't scan %T into Geometry", src)
+	}
+	return err
+}
+
+// Helpers
+
+// geomNode is a decoded geometry
+type geomNode struct {
+	kind       uint32
+	hasZ, hasM bool
+	// Point (empty if no coordinates) and LineString
+	points [][]float64
+	// Polygon
+	rings [][][]float64
+	// Multi geometries and collections
+	parts []geomNode
+}
+
+func (n *geomNode) dims() int {
+	d := 2
+	if n.hasZ {
+		d++
+	}
+	if n.hasM {
+		d++
+	}
+	return d
+}
+
+func (n *geomNode) setDims(hasZ bool, hasM bool) {
+	n.hasZ, n.hasM = hasZ, hasM
+	for i := range n.parts {
+		n.parts[i].setDims(hasZ, hasM)
+	}
+}
+
+func (n *geomNode) writeWKT(sb *strings.Builder, tag bool) {
+	if tag {
+		sb.WriteString(geomNames[n.kind])
+		switch {
+		case n.hasZ && n.hasM:
+			sb.WriteString(" ZM")
+		case n.hasZ:
+			sb.WriteString(" Z")
+		case n.hasM:
+			sb.WriteString(" M")
+		}
+		sb.WriteByte(' ')
+	}
+	switch n.kind {
+	case geomPoint, geomLineString:
+		writeWKTPoints(sb, n.points)
+	case geomPolygon:
+		if len(n.rings) == 0 {
+			sb.WriteString("EMPTY")
+			return
+		}
+		sb.WriteByte('(')
+		for i, ring := range n.rings {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeWKTPoints(sb, ring)
+		}
+		sb.WriteByte(')')
+	default:
+		if len(n.parts) == 0 {
+			sb.WriteString("EMPTY")
+			return
+		}
+		sb.WriteByte('(')
+		for i := range n.parts {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			// Only the parts of collections have their type
+			n.parts[i].writeWKT(sb, n.kind == geomCollection)
+		}
+		sb.WriteByte(')')
+	}
+}
+
+func writeWKTPoints(sb *strings.Builder, points [][]float64) {
+	if len(points) == 0 {
+		sb.WriteString("EMPTY")
+		return
+	}
+	sb.WriteByte('(')
+	for i, point := range points {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		for j, c := range point {
+			if j > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(strconv.FormatFloat(c, 'f', -1, 64))
+		}
+	}
+	sb.WriteByte(')')
+}
+
+type wkbReader struct {
+	data  []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+func (r *wkbReader) readUint32() (uint32, error) {
+	if r.pos+4 > len(r.data) {
+		return 0, errors.Errorf("unexpected end of EWKB")
+	}
+	v := r.order.Uint32(r.data[r.pos:])
+	r.pos += 4
+	return v, nil
+}
+
+func (r *wkbReader) readFloat64() (float64, error) {
+	if r.pos+8 > len(r.data) {
+		return 0, errors.Errorf("unexpected end of EWKB")
+	}
+	v := math.Float64frombits(r.order.Uint64(r.data[r.pos:]))
+	r.pos += 8
+	return v, nil
+}
+
+// readHeader reads the byte order, the type with its flags and the SRID
+func (r *wkbReader) readHeader() (geomNode, int32, error) {
+	var n geomNode
+	if r.pos >= len(r.data) {
+		return n, 0, errors.Errorf("unexpected end of EWKB")
+	}
+	switch r.data[r.pos] {
+	case 0:
+		r.order = binary.BigEndian
+	case 1:
+		r.order = binary.LittleEndian
+	default:
+		return n, 0, errors.Errorf("invalid EWKB byte order: %d", r.data[r.pos])
+	}
+	r.pos++
+	kind, err := r.readUint32()
+	if err != nil {
+		return n, 0, err
+	}
+	n.hasZ = kind&ewkbZ != 0
+	n.hasM = kind&ewkbM != 0
+	var srid int32
+	if kind&ewkbSRID != 0 {
+		v, err := r.readUint32()
+		if err != nil {
+			return n, 0, err
+		}
+		srid = int32(v)
+	}
+	kind &^= ewkbZ | ewkbM | ewkbSRID
+	// ISO WKB dimensions: 1000 Z, 2000 M, 3000 ZM
+	switch kind / 1000 {
+	case 1:
+		n.hasZ = true
+	case 2:
+		n.hasM = true
+	case 3:
+		n.hasZ, n.hasM = true, true
+	}
+	n.kind = kind % 1000
+	if _, ok := geomNames[n.kind]; !ok {
+		return n, 0, errors.Errorf("unknown geometry type: %d", kind)
+	}
+	return n, srid, nil
+}
+
+func (r *wkbReader) readGeometry() (geomNode, error) {
+	n, _, err := r.readHeader()
+	if err != nil {
+		return n, err
+	}
+	switch n.kind {
+	case geomPoint:
+		point, err := r.readPoint(n.dims())
+		if err != nil {
+			return n, err
+		}
+		// Empty points have NaN coordinates
+		if !math.IsNaN(point[0]) {
+			n.points = [][]float64{point}
+		}
+	case geomLineString:
+		n.points, err = r.readPoints(n.dims())
+	case geomPolygon:
+		var count uint32
+		count, err = r.readUint32()
+		for i := uint32(0); err == nil && i < count; i++ {
+			var ring [][]float64
+			ring, err = r.readPoints(n.dims())
+			n.rings = append(n.rings, ring)
+		}
+	default:
+		var count uint32
+		count, err = r.readUint32()
+		for i := uint32(0); err == nil && i < count; i++ {
+			var part geomNode
+			part, err = r.readGeometry()
+			n.parts = append(n.parts, part)
+		}
+	}
+	return n, err
+}
+
+func (r *wkbReader) readPoints(dims int) ([][]float64, error) {
+	count, err := r.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if int(count) > (len(r.data)-r.pos)/(8*dims) {
+		return nil, errors.Errorf("unexpected end of EWKB")
+	}
+	points := make([][]float64, count)
+	for i := range points {
+		points[i], err = r.readPoint(dims)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+func (r *wkbReader) readPoint(dims int) ([]float64, error) {
+	var err error
+	point := make([]float64, dims)
+	for i := range point {
+		point[i], err = r.readFloat64()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return point, nil
+}
+
+// wkbWriter writes EWKB in big endian, as H2 does
+type wkbWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *wkbWriter) writeUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.buf.Write(b[:])
+}
+
+func (w *wkbWriter) writePoints(points [][]float64) {
+	w.writeUint32(uint32(len(points)))
+	for _, point := range points {
+		w.writePoint(point)
+	}
+}
+
+func (w *wkbWriter) writePoint(point []float64) {
+	var b [8]byte
+	for _, c := range point {
+		binary.BigEndian.PutUint64(b[:], math.Float64bits(c))
+		w.buf.Write(b[:])
+	}
+}
+
+func (w *wkbWriter) writeGeometry(n geomNode, srid int32, top bool) {
+	w.buf.WriteByte(0)
+	kind := n.kind
+	if n.hasZ {
+		kind |= ewkbZ
+	}
+	if n.hasM {
+		kind |= ewkbM
+	}
+	if top && srid != 0 {
+		kind |= ewkbSRID
+	}
+	w.writeUint32(kind)
+	if kind&ewkbSRID != 0 {
+		w.writeUint32(uint32(srid))
+	}
+	switch n.kind {
+	case geomPoint:
+		if len(n.points) == 0 {
+			empty := make([]float64, n.dims())
+			for i := range empty {
+				empty[i] = math.NaN()
+			}
+			w.writePoint(empty)
+		} else {
+			w.writePoint(n.points[0])
+		}
+	case geomLineString:
+		w.writePoints(n.points)
+	case geomPolygon:
+		w.writeUint32(uint32(len(n.rings)))
+		for _, ring := range n.rings {
+			w.writePoints(ring)
+		}
+	default:
+		w.writeUint32(uint32(len(n.parts)))
+		for _, part := range n.parts {
+			w.writeGeometry(part, 0, false)
+		}
+	}
+}
+
+func tokenizeWKT(text string) []string {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, text[i:i+1])
+			i++
+		default:
+			j := i
+			for j < len(text) && !strings.ContainsRune(" \t\n\r(),", rune(text[j])) {
+				j++
+			}
+			tokens = append(tokens, text[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+type wktParser struct {
+	tokens []string
+	pos    int
+	// Coordinates per point: 0 until known
+	dims int
+}
+
+func (p *wktParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *wktParser) expect(token string) error {
+	if p.peek() != token {
+		return errors.Errorf("expected %q but found %q", token, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *wktParser) parseGeometry() (geomNode, error) {
+	var n geomNode
+	name := strings.ToUpper(p.peek())
+	for kind, kindName := range geomNames {
+		if name == kindName {
+			n.kind = kind
+		}
+	}
+	if n.kind == 0 {
+		return n, errors.Errorf("unknown geometry type %q", p.peek())
+	}
+	p.pos++
+	switch strings.ToUpper(p.peek()) {
+	case "Z":
+		n.hasZ = true
+	case "M":
+		n.hasM = true
+	case "ZM":
+		n.hasZ, n.hasM = true, true
+	}
+	if n.hasZ || n.hasM {
+		p.pos++
+		p.dims = n.dims()
+	}
+	err := p.parseBody(&n)
+	return n, err
+}
+
+func (p *wktParser) parseBody(n *geomNode) error {
+	var err error
+	if strings.ToUpper(p.peek()) == "EMPTY" {
+		p.pos++
+		return nil
+	}
+	switch n.kind {
+	case geomPoint:
+		n.points, err = p.parsePoints()
+		if err == nil && len(n.points) != 1 {
+			return errors.Errorf("a point needs one coordinate")
+		}
+		return err
+	case geomLineString:
+		n.points, err = p.parsePoints()
+		return err
+	case geomPolygon:
+		return p.parseList(func() error {
+			ring, err := p.parsePoints()
+			n.rings = append(n.rings, ring)
+			return err
+		})
+	}
+	return p.parseList(func() error {
+		part := geomNode{kind: n.kind - 3}
+		var err error
+		switch {
+		case n.kind == geomCollection:
+			part, err = p.parseGeometry()
+		case n.kind == geomMultiPoint && p.peek() != "(":
+			// MULTIPOINT (1 2, 3 4)
+			var point []float64
+			point, err = p.parsePoint()
+			part.points = [][]float64{point}
+		default:
+			err = p.parseBody(&part)
+		}
+		n.parts = append(n.parts, part)
+		return err
+	})
+}
+
+// parseList parses comma separated items between parenthesis
+func (p *wktParser) parseList(item func() error) error {
+	err := p.expect("(")
+	if err != nil {
+		return err
+	}
+	for {
+		err = item()
+		if err != nil {
+			return err
+		}
+		if p.peek() != "," {
+			break
+		}
+		p.pos++
+	}
+	return p.expect(")")
+}
+
+func (p *wktParser) parsePoints() ([][]float64, error) {
+	var points [][]float64
+	err := p.parseList(func() error {
+		point, err := p.parsePoint()
+		points = append(points, point)
+		return err
+	})
+	return points, err
+}
+
+func (p *wktParser) parsePoint() ([]float64, error) {
+	var point []float64
+	for p.peek() != "," && p.peek() != ")" && p.peek() != "" {
+		c, err := strconv.ParseFloat(p.peek(), 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid coordinate %q", p.peek())
+		}
+		point = append(point, c)
+		p.pos++
+	}
+	if len(point) < 2 || len(point) > 4 {
+		return nil, errors.Errorf("invalid number of coordinates: %d", len(point))
+	}
+	if p.dims == 0 {
+		p.dims = len(point)
+	}
+	if len(point) != p.dims {
+		return nil, errors.Errorf("mixed coordinate dimensions")
+	}
+	return point, nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"context"
+	"time"
+)
+
+// HookOp is an operation observed by a Hook
+type HookOp int
+
+// Operations
+const (
+	// Statement prepared with Prepare
+	OpPrepare HookOp = iota
+	// Query, including its first rows
+	OpQuery
+	// Statement run with Exec
+	OpExec
+	// Next rows of a query
+	OpFetch
+	OpCommit
+	OpRollback
+)
+
+var hookOpNames = []string{"prepare", "query", "exec", "fetch", "commit", "rollback"}
+
+func (op HookOp) String() string {
+	if op >= 0 && int(op) < len(hookOpNames) {
+		return hookOpNames[op]
+	}
+	return "unknown"
+}
+
+// HookEvent describes an operation
+type HookEvent struct {
+	Op HookOp
+	// SQL text, as given by the application
+	Query   string
+	NumArgs int
+	// Rows updated by an exec or read by a query or fetch; set after the operation
+	Rows int64
+	// Set after the operation
+	Duration time.Duration
+	Err      error
+}
+
+// Hook is called around the operations of the connections, as for tracing or slow query logs.
+// The context returned by Before is given to After; fetches get the context of their query,
+// and commits and rollbacks the one of their transaction.
+type Hook interface {
+	Before(ctx context.Context, ev *HookEvent) context.Context
+	After(ctx context.Context, ev *HookEvent)
+}
+
+// Helpers
+
+// hookCall is an operation in progress
+type hookCall struct {
+	hook  Hook
+	ctx   context.Context
+	ev    HookEvent
+	start time.Time
+}
+
+// startHook calls the hook before an operation; nil if there isn't a hook
+func startHook(ctx context.Context, hook Hook, op HookOp, query string, numArgs int) *hookCall {
+	if hook == nil {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	hc := &hookCall{hook: hook, ev: HookEvent{Op: op, Query: query, NumArgs: numArgs}}
+	hc.ctx = hook.Before(ctx, &hc.ev)
+	if hc.ctx == nil {
+		hc.ctx = ctx
+	}
+	hc.start = time.Now()
+	return hc
+}
+
+// end calls the hook after the operation
+func (hc *hookCall) end(rows int64, err error) {
+	if hc == nil {
+		return
+	}
+	hc.ev.Duration = time.Since(hc.start)
+	hc.ev.Rows = rows
+	hc.ev.Err = err
+	hc.hook.After(hc.ctx, &hc.ev)
+}
+
+// context gets the context of the operation
+func (hc *hookCall) context(ctx context.Context) context.Context {
+	if hc == nil {
+		return ctx
+	}
+	return hc.ctx
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Interval qualifiers as sent by the server
+const (
+	intervalYear int8 = iota
+	intervalMonth
+	intervalDay
+	intervalHour
+	intervalMinute
+	intervalSecond
+	intervalYearToMonth
+	intervalDayToHour
+	intervalDayToMinute
+	intervalDayToSecond
+	intervalHourToMinute
+	intervalHourToSecond
+	intervalMinuteToSecond
+)
+
+// Interval is a year-month interval (INTERVAL YEAR, INTERVAL MONTH or INTERVAL YEAR TO MONTH).
+// Day-time intervals are mapped to time.Duration.
+// Both fields have the same sign.
+type Interval struct {
+	Years  int64
+	Months int64
+}
+
+// TotalMonths gets the length of the interval in months
+func (i Interval) TotalMonths() int64 {
+	return i.Years*12 + i.Months
+}
+
+// String gets the interval as a year-month literal: [-]years-months
+func (i Interval) String() string {
+	total := i.TotalMonths()
+	sign := ""
+	if total < 0 {
+		sign = "-"
+		total = -total
+	}
+	return sign + strconv.FormatInt(total/12, 10) + "-" + strconv.FormatInt(total%12, 10)
+}
+
+// Scan implements sql.Scanner
+func (i *Interval) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case Interval:
+		*i = v
+	case nil:
+		return errors.Errorf("can't scan NULL into Interval")
+	default:
+		return errors.Errorf("can't scan %T into Interval", src)
+	}
+	return nil
+}
+
+// Day-time qualifiers: units of the leading and remaining fields
+var intervalUnits = map[int8][2]time.Duration{
+	intervalDay:            {24 * time.Hour, 0},
+	intervalHour:           {time.Hour, 0},
+	intervalMinute:         {time.Minute, 0},
+	intervalSecond:         {time.Second, time.Nanosecond},
+	intervalDayToHour:      {24 * time.Hour, time.Hour},
+	intervalDayToMinute:    {24 * time.Hour, time.Minute},
+	intervalDayToSecond:    {24 * time.Hour, time.Nanosecond},
+	intervalHourToMinute:   {time.Hour, time.Minute},
+	intervalHourToSecond:   {time.Hour, time.Nanosecond},
+	intervalMinuteToSecond: {time.Minute, time.Nanosecond},
+}
+
+// newInterval builds the Go value of an interval: Interval for year-month qualifiers and
+// time.Duration for day-time ones
+func newInterval(qualifier int8, negative bool, leading int64, remaining int64) (interface{}, error) {
+	sign := int64(1)
+	if negative {
+		sign = -1
+	}
+	switch qualifier {
+	case intervalYear:
+		return Interval{Years: sign * leading}, nil
+	case intervalMonth:
+		return Interval{Months: sign * leading}, nil
+	case intervalYearToMonth:
+		return Interval{Years: sign * leading, Months: sign * remaining}, nil
+	}
+	units, ok := intervalUnits[qualifier]
+	if !ok {
+		return nil, errors.Errorf("unknown interval qualifier: %d", qualifier)
+	}
+	if leading < 0 || remaining < 0 || leading > math.MaxInt64/int64(units[0]) {
+		return nil, errors.Errorf("interval out of time.Duration range")
+	}
+	d := time.Duration(leading) * units[0]
+	if units[1] != 0 {
+		if remaining > int64(math.MaxInt64-d)/int64(units[1]) {
+			return nil, errors.Errorf("interval out of time.Duration range")
+		}
+		d += time.Duration(remaining) * units[1]
+	}
+	return time.Duration(sign) * d, nil
+}
@@ -0,0 +1,320 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"encoding/binary"
+	"math"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// Java serialization stream
+const (
+	javaStreamMagic   = 0xaced
+	javaStreamVersion = 5
+
+	javaTCNull      = 0x70
+	javaTCClassDesc = 0x72
+	javaTCObject    = 0x73
+	javaTCString    = 0x74
+	javaTCEndBlock  = 0x78
+	javaTCLongStr   = 0x7c
+)
+
+// JavaObject is a JAVA_OBJECT (OTHER) value: a serialized Java object.
+// It's sent back unchanged when used as parameter.
+type JavaObject []byte
+
+// Decode decodes the serialized object if it's a string or a primitive wrapper (java.lang.Integer,
+// java.lang.Long, ...) into the matching Go value: string, int32, int64, int16, int8, bool,
+// float64, float32 or string (java.lang.Character)
+func (o JavaObject) Decode() (interface{}, error) {
+	r := &javaReader{data: o}
+	magic, err := r.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	version, err := r.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	if magic != javaStreamMagic || version != javaStreamVersion {
+		return nil, errors.Errorf("not a Java serialization stream")
+	}
+	v, err := r.readContent()
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't decode Java object")
+	}
+	return v, nil
+}
+
+// Scan implements sql.Scanner
+func (o *JavaObject) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case JavaObject:
+		*o = v
+	case []byte:
+		*o = append(JavaObject(nil), v...)
+	case nil:
+		*o = nil
+	default:
+		return errors.Errorf("can't scan %T into JavaObject", src)
+	}
+	return nil
+}
+
+// Helpers
+
+type javaReader struct {
+	data []byte
+	pos  int
+}
+
+// javaField is a field of a serializable class
+type javaField struct {
+	kind byte
+	name string
+}
+
+func (r *javaReader) read(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, errors.Errorf("unexpected end of Java serialization stream")
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *javaReader) readByte() (byte, error) {
+	b, err := r.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *javaReader) readUint16() (uint16, error) {
+	b, err := r.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+func (r *javaReader) readUint32() (uint32, error) {
+	b, err := r.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (r *javaReader) readUint64() (uint64, error) {
+	b, err := r.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// readUTF reads a string in modified UTF-8 with its length
+func (r *javaReader) readUTF(long bool) (string, error) {
+	var n uint64
+	var err error
+	if long {
+		n, err = r.readUint64()
+	} else {
+		var n16 uint16
+		n16, err = r.readUint16()
+		n = uint64(n16)
+	}
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(len(r.data)) {
+		return "", errors.Errorf("invalid string length: %d", n)
+	}
+	b, err := r.read(int(n))
+	if err != nil {
+		return "", err
+	}
+	return decodeModifiedUTF8(b)
+}
+
+func (r *javaReader) readContent() (interface{}, error) {
+	tc, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tc {
+	case javaTCNull:
+		return nil, nil
+	case javaTCString:
+		return r.readUTF(false)
+	case javaTCLongStr:
+		return r.readUTF(true)
+	case javaTCObject:
+		return r.readObject()
+	}
+	return nil, errors.Errorf("unsupported Java serialization content: 0x%x", tc)
+}
+
+// readObject reads an object whose classes have only primitive fields
+func (r *javaReader) readObject() (interface{}, error) {
+	tc, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if tc != javaTCClassDesc {
+		return nil, errors.Errorf("unsupported Java class descriptor: 0x%x", tc)
+	}
+	className, err := r.readUTF(false)
+	if err != nil {
+		return nil, err
+	}
+	// Class hierarchy from the class to its superclasses
+	var hierarchy [][]javaField
+	for {
+		fields, err := r.readClassFields()
+		if err != nil {
+			return nil, err
+		}
+		hierarchy = append(hierarchy, fields)
+		tc, err = r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if tc == javaTCNull {
+			break
+		}
+		if tc != javaTCClassDesc {
+			return nil, errors.Errorf("unsupported Java class descriptor: 0x%x", tc)
+		}
+		// Superclass name
+		_, err = r.readUTF(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Values from the topmost superclass
+	values := map[string]interface{}{}
+	for i := len(hierarchy) - 1; i >= 0; i-- {
+		for _, field := range hierarchy[i] {
+			values[field.name], err = r.readPrimitive(field.kind)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	switch className {
+	case "java.lang.Integer", "java.lang.Long", "java.lang.Short", "java.lang.Byte",
+		"java.lang.Boolean", "java.lang.Double", "java.lang.Float":
+		return values["value"], nil
+	case "java.lang.Character":
+		c, _ := values["value"].(uint16)
+		return string(utf16.Decode([]uint16{c})), nil
+	}
+	return nil, errors.Errorf("unsupported Java class %s", className)
+}
+
+// readClassFields reads the rest of a class descriptor
+func (r *javaReader) readClassFields() ([]javaField, error) {
+	// Serial version UID and flags
+	_, err := r.read(9)
+	if err != nil {
+		return nil, err
+	}
+	count, err := r.readUint16()
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]javaField, count)
+	for i := range fields {
+		fields[i].kind, err = r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		fields[i].name, err = r.readUTF(false)
+		if err != nil {
+			return nil, err
+		}
+		if fields[i].kind == 'L' || fields[i].kind == '[' {
+			return nil, errors.Errorf("unsupported object field %s", fields[i].name)
+		}
+	}
+	// Class annotations
+	tc, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if tc != javaTCEndBlock {
+		return nil, errors.Errorf("unsupported Java class annotation")
+	}
+	return fields, nil
+}
+
+func (r *javaReader) readPrimitive(kind byte) (interface{}, error) {
+	switch kind {
+	case 'B':
+		b, err := r.readByte()
+		return int8(b), err
+	case 'Z':
+		b, err := r.readByte()
+		return b != 0, err
+	case 'C':
+		return r.readUint16()
+	case 'S':
+		v, err := r.readUint16()
+		return int16(v), err
+	case 'I':
+		v, err := r.readUint32()
+		return int32(v), err
+	case 'F':
+		v, err := r.readUint32()
+		return math.Float32frombits(v), err
+	case 'J':
+		v, err := r.readUint64()
+		return int64(v), err
+	case 'D':
+		v, err := r.readUint64()
+		return math.Float64frombits(v), err
+	}
+	return nil, errors.Errorf("unknown Java field type %q", kind)
+}
+
+// decodeModifiedUTF8 decodes Java modified UTF-8: UTF-16 units with 1 to 3 bytes each
+func decodeModifiedUTF8(b []byte) (string, error) {
+	units := make([]uint16, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		x := b[i]
+		switch {
+		case x < 0x80:
+			units = append(units, uint16(x))
+		case x >= 0xe0 && i+2 < len(b):
+			units = append(units, uint16(x&0xf)<<12|uint16(b[i+1]&0x3f)<<6|uint16(b[i+2]&0x3f))
+			i += 2
+		case x >= 0xc0 && x < 0xe0 && i+1 < len(b):
+			units = append(units, uint16(x&0x1f)<<6|uint16(b[i+1]&0x3f))
+			i++
+		default:
+			return "", errors.Errorf("invalid modified UTF-8 string")
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// JSON wraps any Go value to scan a JSON column into it, or to send it marshalled as a JSON parameter.
+//
+//	var payload Event
+//	err := row.Scan(h2go.JSON{V: &payload})
+type JSON struct {
+	V interface{}
+}
+
+// Scan implements sql.Scanner
+func (j JSON) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		data = []byte("null")
+	default:
+		return errors.Errorf("can't scan %T as JSON", src)
+	}
+	err := json.Unmarshal(data, j.V)
+	if err != nil {
+		return errors.Wrapf(err, "can't unmarshal JSON value")
+	}
+	return nil
+}
+
+// Value implements driver.Valuer
+func (j JSON) Value() (driver.Value, error) {
+	data, err := j.marshal()
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (j JSON) marshal() (json.RawMessage, error) {
+	data, err := json.Marshal(j.V)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't marshal %T as JSON", j.V)
+	}
+	return data, nil
+}
+
+// toJSON gets the JSON text of a parameter declared as JSON
+func toJSON(v driver.Value) (driver.Value, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case json.RawMessage:
+		return x, nil
+	case []byte:
+		if !json.Valid(x) {
+			return nil, errors.Errorf("invalid JSON text")
+		}
+		return json.RawMessage(x), nil
+	case string, bool, int64, float64:
+		// Converted by the server to a JSON scalar
+		return v, nil
+	}
+	return JSON{V: v}.marshal()
+}
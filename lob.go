@@ -0,0 +1,362 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Sent after the data of every inline LOB
+	lobMagic int32 = 0x1234
+	// Max bytes requested on each LOB read (the server limit)
+	lobReadSize = 64 * 1024
+	// With streamed LOBs, smaller ones are still read when the row is scanned
+	lobInlineLimit = 1024 * 1024
+)
+
+// Lob is a BLOB or CLOB value stored in the server, read on demand with io.Reader and io.ReaderAt.
+// CLOB data is read as UTF-8.
+//
+// LOBs are returned as []byte (BLOB) or string (CLOB). With streamed LOBs (Config.StreamLobs),
+// the ones over 1 MiB are returned as *Lob and read from the server while the rows are open:
+//
+//	for rows.Next() {
+//		var doc h2go.Lob
+//		err = rows.Scan(&doc)
+//		_, err = io.Copy(w, &doc)
+//	}
+//
+// Once the rows are closed, its connection can be used by others and the LOB can't be read.
+type Lob struct {
+	kind      int32
+	tableID   int32
+	lobID     int64
+	hmac      []byte
+	precision int64
+	offset    int64
+	// Data of LOBs scanned from in memory values
+	data []byte
+	// Result the LOB was read from
+	res *h2Result
+}
+
+// IsClob gets if it's a CLOB
+func (l *Lob) IsClob() bool {
+	return l.kind == ValueClob
+}
+
+// Size gets the length of the LOB: bytes for BLOB and characters for CLOB
+func (l *Lob) Size() int64 {
+	return l.precision
+}
+
+// Read implements io.Reader
+func (l *Lob) Read(p []byte) (int, error) {
+	n, err := l.ReadAt(p, l.offset)
+	l.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt
+func (l *Lob) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.Errorf("negative LOB offset: %d", off)
+	}
+	if l.data != nil {
+		if off >= int64(len(l.data)) {
+			return 0, io.EOF
+		}
+		n := copy(p, l.data[off:])
+		if n < len(p) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+	if l.res == nil {
+		return 0, errors.Errorf("LOB can't be read: not linked to a connection")
+	}
+	if l.res.closed {
+		return 0, errors.Errorf("LOB can't be read: its rows are closed")
+	}
+	total := 0
+	for total < len(p) {
+		size := len(p) - total
+		if size > lobReadSize {
+			size = lobReadSize
+		}
+		data, err := l.res.sess.readLob(l.res.trans, l.lobID, l.hmac, off+int64(total), int32(size))
+		if err != nil {
+			return total, err
+		}
+		if len(data) == 0 {
+			return total, io.EOF
+		}
+		total += copy(p[total:], data)
+	}
+	return total, nil
+}
+
+// Bytes reads the whole LOB
+func (l *Lob) Bytes() ([]byte, error) {
+	if l.data != nil {
+		return l.data, nil
+	}
+	var data []byte
+	buf := make([]byte, lobReadSize)
+	var off int64
+	for {
+		n, err := l.ReadAt(buf, off)
+		data = append(data, buf[:n]...)
+		off += int64(n)
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Scan implements sql.Scanner
+func (l *Lob) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case *Lob:
+		*l = *v
+		l.offset = 0
+	case []byte:
+		*l = Lob{kind: ValueBlob, data: v, precision: int64(len(v))}
+	case string:
+		*l = Lob{kind: ValueClob, data: []byte(v), precision: utf16Len(v)}
+	case nil:
+		return errors.Errorf("can't scan NULL into Lob")
+	default:
+		return errors.Errorf("can't scan %T into Lob", src)
+	}
+	return nil
+}
+
+// Helpers
+
+// inline gets the value of a LOB read into memory
+func (l *Lob) inline() (interface{}, error) {
+	data, err := l.Bytes()
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read LOB")
+	}
+	if l.IsClob() {
+		return string(data), nil
+	}
+	return data, nil
+}
+
+func utf16Len(s string) int64 {
+	var n int64
+	for _, r := range s {
+		n += int64(utf16RuneLen(r))
+	}
+	return n
+}
+
+func utf16RuneLen(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
+
+// lobSource is a reader of known length ready to be sent as a LOB
+type lobSource struct {
+	r io.Reader
+	// Bytes for BLOB, characters for CLOB
+	length  int64
+	cleanup func()
+}
+
+// newLobSource gets the length of a reader without reading it into memory: from its size or by
+// seeking it if possible, and else by spooling it into a temporary file
+func newLobSource(r io.Reader, clob bool) (*lobSource, error) {
+	src := &lobSource{r: r, cleanup: func() {}}
+	if !clob {
+		if sized, ok := r.(interface{ Len() int }); ok {
+			src.length = int64(sized.Len())
+			return src, nil
+		}
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		length, err := seekLength(r, seeker, clob)
+		if err == nil {
+			src.length = length
+			return src, nil
+		}
+	}
+	return spoolLob(r, clob)
+}
+
+// seekLength gets the length of a seekable reader from its current position
+func seekLength(r io.Reader, seeker io.Seeker, clob bool) (int64, error) {
+	cur, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if !clob {
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		_, err = seeker.Seek(cur, io.SeekStart)
+		return end - cur, err
+	}
+	length, err := countChars(r)
+	if err != nil {
+		return 0, err
+	}
+	_, err = seeker.Seek(cur, io.SeekStart)
+	return length, err
+}
+
+func spoolLob(r io.Reader, clob bool) (*lobSource, error) {
+	f, err := ioutil.TempFile("", "h2go-lob")
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't create temporary file for LOB")
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	var length int64
+	if clob {
+		length, err = countChars(io.TeeReader(r, f))
+	} else {
+		length, err = io.Copy(f, r)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, errors.Wrapf(err, "can't spool LOB into temporary file")
+	}
+	return &lobSource{r: f, length: length, cleanup: cleanup}, nil
+}
+
+// countChars counts the UTF-16 characters of UTF-8 text, as H2 measures CLOBs
+func countChars(r io.Reader) (int64, error) {
+	var n int64
+	br := bufio.NewReader(r)
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n += int64(utf16RuneLen(c))
+	}
+}
+
+// writeChars sends UTF-8 text as H2 characters: UTF-16 units with 1 to 3 bytes each
+func writeChars(w io.ByteWriter, r io.Reader) (int64, error) {
+	var n int64
+	br := bufio.NewReader(r)
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		units := []uint16{uint16(c)}
+		if utf16RuneLen(c) == 2 {
+			r1, r2 := utf16.EncodeRune(c)
+			units = []uint16{uint16(r1), uint16(r2)}
+		}
+		for _, u := range units {
+			err = writeChar(w, u)
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+}
+
+func writeChar(w io.ByteWriter, c uint16) error {
+	switch {
+	case c < 0x80:
+		return w.WriteByte(byte(c))
+	case c >= 0x800:
+		err := w.WriteByte(byte(0xe0 | (c >> 12)))
+		if err == nil {
+			err = w.WriteByte(byte(0x80 | ((c >> 6) & 0x3f)))
+		}
+		if err == nil {
+			err = w.WriteByte(byte(0x80 | (c & 0x3f)))
+		}
+		return err
+	default:
+		err := w.WriteByte(byte(0xc0 | (c >> 6)))
+		if err == nil {
+			err = w.WriteByte(byte(0x80 | (c & 0x3f)))
+		}
+		return err
+	}
+}
+
+// readChars reads n H2 characters as a string
+func readChars(r io.ByteReader, n int64) (string, error) {
+	units := make([]uint16, 0, n)
+	for i := int64(0); i < n; i++ {
+		x, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case x < 0x80:
+			units = append(units, uint16(x))
+		case x >= 0xe0:
+			b1, err := r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			b2, err := r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			units = append(units, uint16(x&0xf)<<12|uint16(b1&0x3f)<<6|uint16(b2&0x3f))
+		default:
+			b1, err := r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			units = append(units, uint16(x&0x1f)<<6|uint16(b1&0x3f))
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
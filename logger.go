@@ -0,0 +1,167 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"fmt"
+	stdlog "log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// LogLevel is the verbosity of the driver logging
+type LogLevel int
+
+// Log levels, from the least to the most verbose
+const (
+	LogNone LogLevel = iota - 1
+	LogError
+	LogWarn
+	LogInfo
+	LogDebug
+	LogTrace
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogNone:  "none",
+	LogError: "error",
+	LogWarn:  "warn",
+	LogInfo:  "info",
+	LogDebug: "debug",
+	LogTrace: "trace",
+}
+
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// ParseLogLevel parses a level name: none, error, warn, info, debug or trace
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(name) {
+	case "warning":
+		return LogWarn, nil
+	case "panic":
+		// The driver doesn't log panics
+		return LogNone, nil
+	}
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return LogNone, errors.Errorf("unknown log level: %s", name)
+}
+
+// Logger gets the driver log messages up to the level of the configuration
+type Logger interface {
+	Log(level LogLevel, msg string)
+}
+
+// NewStdLogger creates a Logger writing to a standard library logger; to stderr if l is nil
+func NewStdLogger(l *stdlog.Logger) Logger {
+	if l == nil {
+		l = stdlog.New(os.Stderr, "h2go: ", stdlog.LstdFlags)
+	}
+	return stdLogger{l}
+}
+
+type stdLogger struct {
+	l *stdlog.Logger
+}
+
+func (s stdLogger) Log(level LogLevel, msg string) {
+	s.l.Printf("[%s] %s", level, msg)
+}
+
+// NewLogrusLogger creates a Logger writing to a logrus logger, which also applies its own level
+func NewLogrusLogger(l *log.Logger) Logger {
+	return logrusLogger{l}
+}
+
+type logrusLogger struct {
+	l *log.Logger
+}
+
+var logrusLevels = map[LogLevel]log.Level{
+	LogError: log.ErrorLevel,
+	LogWarn:  log.WarnLevel,
+	LogInfo:  log.InfoLevel,
+	LogDebug: log.DebugLevel,
+	LogTrace: log.TraceLevel,
+}
+
+func (r logrusLogger) Log(level LogLevel, msg string) {
+	if lvl, ok := logrusLevels[level]; ok {
+		r.l.Log(lvl, msg)
+	}
+}
+
+// logger filters the messages of a connector by level and hides its password
+type logger struct {
+	out    Logger
+	level  LogLevel
+	secret string
+}
+
+func newLogger(cfg *Config) *logger {
+	if cfg.Logger == nil || cfg.LogLevel <= LogNone {
+		return nil
+	}
+	return &logger{out: cfg.Logger, level: cfg.LogLevel, secret: cfg.Password}
+}
+
+// L Log if apply
+func (l *logger) L(level LogLevel, text string, args ...interface{}) {
+	if l == nil || level > l.level {
+		return
+	}
+	msg := fmt.Sprintf(text, args...)
+	if l.secret != "" {
+		msg = strings.Replace(msg, l.secret, "xxxxx", -1)
+	}
+	l.out.Log(level, msg)
+}
+
+// redactDSN hides the password of a connection string
+func redactDSN(dsn string) string {
+	if strings.HasPrefix(strings.ToLower(dsn), jdbcPrefix) {
+		settings := strings.Split(dsn, ";")
+		for i, setting := range settings {
+			if i > 0 && strings.HasPrefix(strings.ToUpper(strings.TrimSpace(setting)), "PASSWORD=") {
+				settings[i] = setting[:strings.Index(setting, "=")+1] + "xxxxx"
+			}
+		}
+		return strings.Join(settings, ";")
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "<invalid DSN>"
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+	}
+	return u.String()
+}
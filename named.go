@@ -0,0 +1,218 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"database/sql/driver"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// namedQuery is a query with the named placeholders (:name and @name) replaced by H2 numbered ones (?N)
+type namedQuery struct {
+	query string
+	// Parameter names in order of first appearance; name at i is bound to ?(i+1)
+	names []string
+	// Found any :name placeholder
+	hasColon bool
+	// Found any @name placeholder
+	hasAt bool
+	// Found any positional placeholder (? or ?N)
+	hasPositional bool
+}
+
+// parseNamedQuery looks for named placeholders, skipping string literals, quoted identifiers and comments
+func parseNamedQuery(query string) (namedQuery, error) {
+	var nq namedQuery
+	var sb strings.Builder
+	indexes := map[string]int{}
+	n := len(query)
+	for i := 0; i < n; {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			// String literal or quoted identifier; doubled quotes are escapes
+			end := i + 1
+			for end < n {
+				if query[end] == c {
+					if end+1 < n && query[end+1] == c {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			if end >= n {
+				return nq, errors.Errorf("unterminated %c quote in query", c)
+			}
+			sb.WriteString(query[i : end+1])
+			i = end + 1
+		case c == '$' && strings.HasPrefix(query[i:], "$$"):
+			// Dollar quoted string
+			end := strings.Index(query[i+2:], "$$")
+			if end < 0 {
+				return nq, errors.Errorf("unterminated $$ quote in query")
+			}
+			end += i + 4
+			sb.WriteString(query[i:end])
+			i = end
+		case strings.HasPrefix(query[i:], "--") || strings.HasPrefix(query[i:], "//"):
+			// Line comment
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = n
+			} else {
+				end += i + 1
+			}
+			sb.WriteString(query[i:end])
+			i = end
+		case strings.HasPrefix(query[i:], "/*"):
+			// Block comment
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return nq, errors.Errorf("unterminated comment in query")
+			}
+			end += i + 4
+			sb.WriteString(query[i:end])
+			i = end
+		case c == ':' && i+1 < n && query[i+1] == ':':
+			// Cast operator
+			sb.WriteString("::")
+			i += 2
+		case (c == ':' || c == '@') && i+1 < n && isNameStart(query[i+1]):
+			end := i + 2
+			for end < n && isNamePart(query[end]) {
+				end++
+			}
+			name := query[i+1 : end]
+			idx, ok := indexes[name]
+			if !ok {
+				nq.names = append(nq.names, name)
+				idx = len(nq.names)
+				indexes[name] = idx
+			}
+			if c == ':' {
+				nq.hasColon = true
+			} else {
+				nq.hasAt = true
+			}
+			sb.WriteString("?" + strconv.Itoa(idx))
+			i = end
+		case c == '?':
+			nq.hasPositional = true
+			sb.WriteByte(c)
+			i++
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	nq.query = sb.String()
+	return nq, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNamePart(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// isNamed tells if the query must be rewritten. @name is also the H2 syntax for user variables,
+// so it's only taken as a placeholder along with :name placeholders or named arguments.
+func (nq namedQuery) isNamed(args []driver.NamedValue) bool {
+	if nq.hasColon {
+		return true
+	}
+	return nq.hasAt && hasNamedArgs(args)
+}
+
+func hasNamedArgs(args []driver.NamedValue) bool {
+	for _, arg := range args {
+		if arg.Name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// bind orders the arguments following the numbered placeholders
+func (nq namedQuery) bind(args []driver.NamedValue) ([]driver.NamedValue, error) {
+	if nq.hasPositional {
+		return nil, errors.Errorf("can't mix positional and named parameters in the same query")
+	}
+	bound := make([]driver.NamedValue, len(nq.names))
+	found := make([]bool, len(nq.names))
+	for _, arg := range args {
+		if arg.Name == "" {
+			return nil, errors.Errorf("positional argument %d given to a query with named parameters", arg.Ordinal)
+		}
+		idx := nq.indexOf(arg.Name)
+		if idx < 0 {
+			return nil, errors.Errorf("unused named argument \"%s\"", arg.Name)
+		}
+		if found[idx] {
+			return nil, errors.Errorf("named argument \"%s\" given more than once", arg.Name)
+		}
+		found[idx] = true
+		bound[idx] = driver.NamedValue{Ordinal: idx + 1, Value: arg.Value}
+	}
+	var missing []string
+	for i, ok := range found {
+		if !ok {
+			missing = append(missing, nq.names[i])
+		}
+	}
+	if len(missing) > 0 {
+		return nil, errors.Errorf("missing named arguments: %s", strings.Join(missing, ", "))
+	}
+	return bound, nil
+}
+
+func (nq namedQuery) indexOf(name string) int {
+	for i, n := range nq.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// rewriteNamed rewrites a query with named placeholders and binds its arguments
+func rewriteNamed(query string, args []driver.NamedValue) (string, []driver.NamedValue, error) {
+	nq, err := parseNamedQuery(query)
+	if err != nil {
+		return "", nil, err
+	}
+	if !nq.isNamed(args) {
+		for _, arg := range args {
+			if arg.Name != "" {
+				return "", nil, errors.Errorf("unused named argument \"%s\"", arg.Name)
+			}
+		}
+		return query, args, nil
+	}
+	args, err = nq.bind(args)
+	if err != nil {
+		return "", nil, err
+	}
+	return nq.query, args, nil
+}
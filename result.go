@@ -17,55 +17,253 @@ limitations under the License.
 package h2go
 
 import (
+	"context"
 	"database/sql/driver"
 	"io"
 
 	"github.com/pkg/errors"
 )
 
+type h2column struct {
+	alias     string
+	schema    string
+	table     string
+	name      string
+	kind      int32
+	precision int64
+	scale     int32
+	nullable  int32
+}
+
+// H2 type names by data type
+var typeNames = map[int32]string{
+	ValueNull:                  "NULL",
+	ValueBoolean:               "BOOLEAN",
+	ValueByte:                  "TINYINT",
+	ValueShort:                 "SMALLINT",
+	ValueInt:                   "INTEGER",
+	ValueLong:                  "BIGINT",
+	ValueDecimal:               "DECIMAL",
+	ValueDouble:                "DOUBLE",
+	ValueFloat:                 "REAL",
+	ValueTime:                  "TIME",
+	ValueDate:                  "DATE",
+	ValueTimestamp:             "TIMESTAMP",
+	ValueBytes:                 "VARBINARY",
+	ValueString:                "VARCHAR",
+	ValueStringIgnoreCase:      "VARCHAR_IGNORECASE",
+	ValueBlob:                  "BLOB",
+	ValueClob:                  "CLOB",
+	ValueArray:                 "ARRAY",
+	ValueResultSet:             "RESULT_SET",
+	ValueJavaObject:            "OTHER",
+	ValueUUID:                  "UUID",
+	ValueStringFixed:           "CHAR",
+	ValueGeometry:              "GEOMETRY",
+	ValueTimestampTZ:           "TIMESTAMP WITH TIME ZONE",
+	ValueEnum:                  "ENUM",
+	typeIntervalYear:           "INTERVAL YEAR",
+	typeIntervalMonth:          "INTERVAL MONTH",
+	typeIntervalDay:            "INTERVAL DAY",
+	typeIntervalHour:           "INTERVAL HOUR",
+	typeIntervalMinute:         "INTERVAL MINUTE",
+	typeIntervalSecond:         "INTERVAL SECOND",
+	typeIntervalYearToMonth:    "INTERVAL YEAR TO MONTH",
+	typeIntervalDayToHour:      "INTERVAL DAY TO HOUR",
+	typeIntervalDayToMinute:    "INTERVAL DAY TO MINUTE",
+	typeIntervalDayToSecond:    "INTERVAL DAY TO SECOND",
+	typeIntervalHourToMinute:   "INTERVAL HOUR TO MINUTE",
+	typeIntervalHourToSecond:   "INTERVAL HOUR TO SECOND",
+	typeIntervalMinuteToSecond: "INTERVAL MINUTE TO SECOND",
+	typeRow:                    "ROW",
+	typeJSON:                   "JSON",
+	ValueTimeTZ:                "TIME WITH TIME ZONE",
+}
+
 type h2Result struct {
 	query   string
-	columns []string
+	columns []h2column
+	// -1 if unknown
 	numRows int32
-	curRow  int32
-	trans   *transfer
+	// Rows read from the server
+	curRow int32
+	oID    int32
+	// Rows of the current fetch
+	rows [][]interface{}
+	pos  int
+	// All rows read from the server
+	done bool
+	// Closed by the application, so its LOBs can't be read
+	closed bool
+	sess   *session
+	trans  *transfer
+	client *h2client
+	// Context of the query, for the hook
+	ctx context.Context
+	// Statement of a one-shot query, closed with the result
+	stmtID   int32
+	ownsStmt bool
 
 	// Interface
 	driver.Rows
+	driver.RowsColumnTypeDatabaseTypeName
+	driver.RowsColumnTypeNullable
+	driver.RowsColumnTypePrecisionScale
 }
 
 // Rows interface
 
 func (h2r *h2Result) Close() error {
-	return nil
+	h2r.closed = true
+	if h2r.done {
+		return nil
+	}
+	h2r.done = true
+	return h2r.free()
 }
 
 func (h2r *h2Result) Columns() []string {
-	return h2r.columns
+	cols := []string{}
+	for _, col := range h2r.columns {
+		if col.alias != "" {
+			cols = append(cols, col.alias)
+		} else {
+			cols = append(cols, col.name)
+		}
+	}
+	return cols
 }
 
 func (h2r *h2Result) Next(dest []driver.Value) error {
 	var err error
-	// log.Printf("LEN: %d", len(dest))
-	if h2r.curRow == h2r.numRows {
-		return io.EOF
+	if h2r.pos == len(h2r.rows) {
+		if h2r.done {
+			return io.EOF
+		}
+		err = h2r.fetch()
+		if err != nil {
+			return err
+		}
+		if len(h2r.rows) == 0 {
+			return io.EOF
+		}
 	}
-	h2r.curRow++
-	next, err := h2r.trans.readBool()
-	if err != nil {
-		return err
+	for i, v := range h2r.rows[h2r.pos] {
+		// LOBs are read now, so they can be scanned into []byte or string; streamed ones after Next
+		if lob, ok := v.(*Lob); ok && (!h2r.trans.streamLobs || lob.Size() <= lobInlineLimit) {
+			v, err = lob.inline()
+			if err != nil {
+				return err
+			}
+		}
+		dest[i] = driver.Value(v)
 	}
-	if !next {
-		return io.EOF
+	h2r.pos++
+	return nil
+}
+
+// fetch reads the next rows from the server
+func (h2r *h2Result) fetch() error {
+	var hook Hook
+	if h2r.client != nil {
+		hook = h2r.client.hook
 	}
-	// log.Printf(">>> DEST: %v", dest)
-	for i := range h2r.columns {
-		v, err := h2r.trans.readValue()
+	hc := startHook(h2r.ctx, hook, OpFetch, h2r.query, 0)
+	err := h2r.sess.fetchRows(h2r.trans, h2r.oID, defaultFetchSize)
+	if err == nil {
+		err = h2r.readRows()
+	}
+	hc.end(int64(len(h2r.rows)), err)
+	return err
+}
+
+// RowsColumnTypeDatabaseTypeName interface
+func (h2r *h2Result) ColumnTypeDatabaseTypeName(index int) string {
+	if name, ok := typeNames[h2r.columns[index].kind]; ok {
+		return name
+	}
+	return ""
+}
+
+// RowsColumnTypeNullable interface
+func (h2r *h2Result) ColumnTypeNullable(index int) (nullable, ok bool) {
+	switch h2r.columns[index].nullable {
+	case columnNoNulls:
+		return false, true
+	case columnNullable:
+		return true, true
+	}
+	return false, false
+}
+
+// RowsColumnTypePrecisionScale interface
+func (h2r *h2Result) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	col := h2r.columns[index]
+	if col.kind != ValueDecimal {
+		return 0, 0, false
+	}
+	return col.precision, int64(col.scale), true
+}
+
+// Helpers
+
+// readRows reads the rows of a fetch
+func (h2r *h2Result) readRows() error {
+	h2r.rows = nil
+	h2r.pos = 0
+	count := int32(defaultFetchSize)
+	if h2r.numRows >= 0 && h2r.numRows-h2r.curRow < count {
+		count = h2r.numRows - h2r.curRow
+	}
+	for i := int32(0); i < count; i++ {
+		next, err := h2r.trans.readBool()
 		if err != nil {
-			return errors.Wrapf(err, "Can't read value")
+			return err
 		}
-		dest[i] = driver.Value(v)
+		if !next {
+			h2r.done = true
+			break
+		}
+		row := make([]interface{}, len(h2r.columns))
+		for j := range row {
+			row[j], err = h2r.trans.readValue()
+			if err != nil {
+				return errors.Wrapf(err, "Can't read value")
+			}
+			if lob, ok := row[j].(*Lob); ok {
+				lob.res = h2r
+			}
+		}
+		h2r.rows = append(h2r.rows, row)
+		h2r.curRow++
+	}
+	if h2r.numRows >= 0 && h2r.curRow >= h2r.numRows {
+		h2r.done = true
+	}
+	if h2r.done {
+		return h2r.free()
+	}
+	return nil
+}
+
+// free closes the result on the server, and its statement if it's a one-shot query
+func (h2r *h2Result) free() error {
+	err := h2r.sess.closeResult(h2r.trans, h2r.oID)
+	if err != nil || !h2r.ownsStmt {
+		return err
+	}
+	h2r.ownsStmt = false
+	return h2r.sess.closeCommand(h2r.trans, h2r.stmtID)
+}
+
+// closeStatement closes the statement of the query along with the result
+func (h2r *h2Result) closeStatement(id int32) error {
+	if h2r.done {
+		// Already freed
+		return h2r.sess.closeCommand(h2r.trans, id)
 	}
+	h2r.stmtID = id
+	h2r.ownsStmt = true
 	return nil
 }
 
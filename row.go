@@ -0,0 +1,107 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"database/sql/driver"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Row is a ROW value (row value expressions like ROW(1, 'a')).
+// H2 doesn't send the field names, so they are named C1, C2, ... as H2 does.
+type Row struct {
+	Names  []string
+	Values []interface{}
+}
+
+func newRow(values []interface{}) Row {
+	names := make([]string, len(values))
+	for i := range names {
+		names[i] = "C" + strconv.Itoa(i+1)
+	}
+	return Row{Names: names, Values: values}
+}
+
+// Get gets the value of a field by name
+func (r Row) Get(name string) (interface{}, bool) {
+	for i, n := range r.Names {
+		if n == name {
+			return r.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// Scan implements sql.Scanner
+func (r *Row) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case Row:
+		*r = v
+	case nil:
+		*r = Row{}
+	default:
+		return errors.Errorf("can't scan %T into Row", src)
+	}
+	return nil
+}
+
+// ResultSet is a result set returned as a column value (e.g. by a function returning a result set).
+// It's fully read in memory and implements driver.Rows, so it can be scanned into a *sql.Rows
+// or iterated directly.
+type ResultSet struct {
+	columns []string
+	rows    [][]interface{}
+	curRow  int
+
+	// Interface
+	driver.Rows
+}
+
+// Columns implements driver.Rows
+func (rs *ResultSet) Columns() []string {
+	return rs.columns
+}
+
+// Close implements driver.Rows
+func (rs *ResultSet) Close() error {
+	return nil
+}
+
+// Next implements driver.Rows
+func (rs *ResultSet) Next(dest []driver.Value) error {
+	if rs.curRow >= len(rs.rows) {
+		return io.EOF
+	}
+	for i, v := range rs.rows[rs.curRow] {
+		dest[i] = v
+	}
+	rs.curRow++
+	return nil
+}
+
+// Len gets the number of rows
+func (rs *ResultSet) Len() int {
+	return len(rs.rows)
+}
+
+// Values gets all the rows
+func (rs *ResultSet) Values() [][]interface{} {
+	return rs.rows
+}
@@ -19,10 +19,10 @@ package h2go
 import (
 	"database/sql/driver"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 )
 
 const (
@@ -50,6 +50,14 @@ const (
 	sessionStatusOk             = 1
 	sessionStatusClosed         = 2
 	sessionStatusOkStateChanged = 3
+
+	// Nullability of columns and parameters
+	columnNoNulls         = 0
+	columnNullable        = 1
+	columnNullableUnknown = 2
+
+	// Rows fetched from the server on each round trip
+	defaultFetchSize = 64
 )
 
 type session struct {
@@ -64,6 +72,7 @@ func (s *session) prepare(t *transfer, sql string) (driver.Stmt, error) {
 	var err error
 	stmt := h2stmt{}
 	// 0. Write SESSION_PREPARE
+	t.stats.command(sessionPrepare)
 	err = t.writeInt32(sessionPrepare)
 	// 1. Write ID
 	stmt.id = s.getNextID()
@@ -90,6 +99,7 @@ func (s *session) prepare(t *transfer, sql string) (driver.Stmt, error) {
 	if err != nil {
 		return stmt, err
 	}
+	t.stats.add(statOpenStatements, 1)
 	// 6. Read Is Query
 	isQuery, err := t.readBool()
 	if err != nil {
@@ -105,114 +115,128 @@ func (s *session) prepare(t *transfer, sql string) (driver.Stmt, error) {
 	if err != nil {
 		return stmt, err
 	}
-	L(log.DebugLevel, "STATUS: %d, IsQuery: %v, Is Read-Only: %v, Num Params: %d", state, isQuery, isRO, numParams)
+	t.L(LogDebug, "STATUS: %d, IsQuery: %v, Is Read-Only: %v, Num Params: %d", state, isQuery, isRO, numParams)
+	stmt.isQuery = isQuery
+	stmt.isRO = isRO
+	stmt.numParams = numParams
 	return stmt, nil
 }
 
-func (s *session) executeQuery(stmt *h2stmt, t *transfer) ([]string, int32, error) {
+func (s *session) executeQuery(stmt *h2stmt, t *transfer, values []driver.Value) (*h2Result, error) {
 	var err error
+	// Check for params
+	if stmt.numParams != int32(len(values)) {
+		return nil, fmt.Errorf("Num expected parameters mismatch: %d != %d", stmt.numParams, len(values))
+	}
 	// 0. Write COMMAND EXECUTE QUERY
-	L(log.DebugLevel, "Execute query")
+	t.L(LogDebug, "Execute query")
+	t.stats.command(sessionCommandExecuteQuery)
 	err = t.writeInt32(sessionCommandExecuteQuery)
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
 	// 1. Write ID of query
-	//st := (*stmt).(h2stmt)
 	err = t.writeInt32(stmt.id)
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
 	// 2. Write Object ID
 	stmt.oID = s.getNextID()
 	err = t.writeInt32(stmt.oID)
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
-	// 3. Write Max rows
-	err = t.writeInt32(200)
+	// 3. Write Max rows (0 = no limit)
+	err = t.writeInt32(0)
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
 	// 4. Write Fetch max size
-	err = t.writeInt32(64)
+	err = t.writeInt32(defaultFetchSize)
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
-	// 4. Write Fetch max size
-	err = t.writeInt32(0)
+	// 5. Write params
+	err = s.writeParameters(stmt, t, values)
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
 
-	// 5. Flush data
+	// 6. Flush data
 	err = t.flush()
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
 	// Read query status
 	status, err := t.readInt32()
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
 	err = s.checkSQLError(status, t)
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
 	colCnt, err := t.readInt32()
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
+	// -1 if unknown (lazy results)
 	rowCnt, err := t.readInt32()
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
-	L(log.DebugLevel, "Status: %d - Num cols: %d - Num rows: %d", status, colCnt, rowCnt)
+	t.L(LogDebug, "Status: %d - Num cols: %d - Num rows: %d", status, colCnt, rowCnt)
 	cols, err := s.readColumns(t, colCnt)
 	if err != nil {
-		return nil, -1, err
+		return nil, err
 	}
-
-	return cols, rowCnt, nil
+	res := &h2Result{columns: cols, numRows: rowCnt, oID: stmt.oID, sess: s, trans: t}
+	t.stats.add(statOpenResults, 1)
+	// First rows come along with the query result
+	err = res.readRows()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
 }
-func (s *session) readColumns(t *transfer, colCnt int32) ([]string, error) {
-	// Alias
-	cols := []string{}
+
+func (s *session) readColumns(t *transfer, colCnt int32) ([]h2column, error) {
+	var err error
+	cols := []h2column{}
 	for i := 0; i < int(colCnt); i++ {
-		alias, err := t.readString()
+		col := h2column{}
+		// Alias
+		col.alias, err = t.readString()
 		if err != nil {
 			return nil, err
 		}
 		// Schema
-		// Ignored
-		_, err = t.readString()
+		col.schema, err = t.readString()
 		if err != nil {
 			return nil, err
 		}
 		// TableName
-		// Ignored
-		_, err = t.readString()
+		col.table, err = t.readString()
 		if err != nil {
 			return nil, err
 		}
 		// Column name
-		colName, err := t.readString()
+		col.name, err = t.readString()
 		if err != nil {
 			return nil, err
 		}
-		// Skip other info
 		// - Value type (int)
-		_, err = t.readInt32()
+		col.kind, err = t.readInt32()
 		if err != nil {
 			return nil, err
 		}
 		// - Precision (long)
-		_, err = t.readLong()
+		col.precision, err = t.readLong()
 		if err != nil {
 			return nil, err
 		}
 		// - Scale (int)
-		_, err = t.readInt32()
+		col.scale, err = t.readInt32()
 		if err != nil {
 			return nil, err
 		}
@@ -227,20 +251,140 @@ func (s *session) readColumns(t *transfer, colCnt int32) ([]string, error) {
 			return nil, err
 		}
 		// - Nullable (int)
-		_, err = t.readInt32()
+		col.nullable, err = t.readInt32()
 		if err != nil {
 			return nil, err
 		}
-		// Set columns name
-		if alias != "" {
-			cols = append(cols, alias)
-		} else {
-			cols = append(cols, colName)
-		}
+		cols = append(cols, col)
 	}
 	return cols, nil
 
 }
+
+func (s *session) fetchRows(t *transfer, oID int32, count int32) error {
+	var err error
+	// 0. Write RESULT FETCH ROWS
+	t.L(LogDebug, "Fetch rows")
+	t.stats.command(sessionResultFetchRows)
+	err = t.writeInt32(sessionResultFetchRows)
+	if err != nil {
+		return err
+	}
+	// 1. Write Object ID
+	err = t.writeInt32(oID)
+	if err != nil {
+		return err
+	}
+	// 2. Write num rows to fetch
+	err = t.writeInt32(count)
+	if err != nil {
+		return err
+	}
+	err = t.flush()
+	if err != nil {
+		return err
+	}
+	// Read status; rows come next
+	status, err := t.readInt32()
+	if err != nil {
+		return err
+	}
+	return s.checkSQLError(status, t)
+}
+
+func (s *session) closeResult(t *transfer, oID int32) error {
+	// Without response: sent along with the next command
+	t.L(LogDebug, "Close result")
+	t.stats.command(sessionResultClose)
+	t.stats.add(statOpenResults, -1)
+	err := t.writeInt32(sessionResultClose)
+	if err != nil {
+		return err
+	}
+	return t.writeInt32(oID)
+}
+
+func (s *session) commit(t *transfer) error {
+	// 0. Write COMMAND COMMIT
+	t.L(LogDebug, "Commit")
+	t.stats.command(sessionCommandCommit)
+	err := t.writeInt32(sessionCommandCommit)
+	if err != nil {
+		return err
+	}
+	err = t.flush()
+	if err != nil {
+		return err
+	}
+	// 1. Read status
+	status, err := t.readInt32()
+	if err != nil {
+		return err
+	}
+	return s.checkSQLError(status, t)
+}
+
+func (s *session) closeCommand(t *transfer, id int32) error {
+	// Without response: sent along with the next command
+	t.L(LogDebug, "Close command %d", id)
+	t.stats.command(sessionCommandClose)
+	t.stats.add(statOpenStatements, -1)
+	err := t.writeInt32(sessionCommandClose)
+	if err != nil {
+		return err
+	}
+	return t.writeInt32(id)
+}
+
+func (s *session) readLob(t *transfer, lobID int64, hmac []byte, offset int64, length int32) ([]byte, error) {
+	var err error
+	// 0. Write LOB READ
+	t.L(LogDebug, "Read LOB %d: %d bytes at %d", lobID, length, offset)
+	t.stats.command(sessionLobRead)
+	err = t.writeInt32(sessionLobRead)
+	if err != nil {
+		return nil, err
+	}
+	// 1. Write LOB ID
+	err = t.writeInt64(lobID)
+	if err != nil {
+		return nil, err
+	}
+	// 2. Write HMAC
+	err = t.writeBytes(hmac)
+	if err != nil {
+		return nil, err
+	}
+	// 3. Write offset and length
+	err = t.writeInt64(offset)
+	if err != nil {
+		return nil, err
+	}
+	err = t.writeInt32(length)
+	if err != nil {
+		return nil, err
+	}
+	err = t.flush()
+	if err != nil {
+		return nil, err
+	}
+	// Read status
+	status, err := t.readInt32()
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkSQLError(status, t)
+	if err != nil {
+		return nil, err
+	}
+	// Read data: length and raw bytes
+	n, err := t.readInt32()
+	if err != nil {
+		return nil, err
+	}
+	return t.readBytesDef(int(n))
+}
+
 func (s *session) getNextID() int32 {
 	s.seqID++
 	return s.seqID
@@ -256,10 +400,11 @@ type h2error struct {
 }
 
 func (s *session) checkSQLError(state int32, t *transfer) error {
-	if state == 1 {
+	if state == sessionStatusOk || state == sessionStatusOkStateChanged {
 		return nil
 	}
 	// SQL Error
+	t.stats.add(statErrors, 1)
 	sqlError, err := t.readString()
 	if err != nil {
 		return errors.Wrapf(err, "SQL Error: unknown")
@@ -300,7 +445,8 @@ func (s *session) executeQueryUpdate(stmt *h2stmt, t *transfer, values []driver.
 		return -1, fmt.Errorf("Num expected parameters mismatch: %d != %d", stmt.numParams, len(values))
 	}
 	// 0. Write COMMAND EXECUTE QUERY
-	L(log.DebugLevel, "Execute query update")
+	t.L(LogDebug, "Execute query update")
+	t.stats.command(sessionCommandExecuteUpdate)
 	err = t.writeInt32(sessionCommandExecuteUpdate)
 	if err != nil {
 		return -1, err
@@ -312,23 +458,10 @@ func (s *session) executeQueryUpdate(stmt *h2stmt, t *transfer, values []driver.
 		return -1, err
 	}
 	// 2. Write params
-	// -- num parameters
-	err = t.writeInt32(stmt.numParams)
+	err = s.writeParameters(stmt, t, values)
 	if err != nil {
 		return -1, err
 	}
-	// -- parameters
-	for idx, value := range values {
-		switch value.(type) {
-		case time.Time:
-			err = t.writeDatetimeValue(value.(time.Time), stmt.parameters[idx])
-		default:
-			err = t.writeValue(value)
-		}
-		if err != nil {
-			return -1, err
-		}
-	}
 	// 3. Write Generate keys mode support
 	// TODO
 	err = t.writeInt32(0)
@@ -339,7 +472,7 @@ func (s *session) executeQueryUpdate(stmt *h2stmt, t *transfer, values []driver.
 	if err != nil {
 		return -1, err
 	}
-	L(log.DebugLevel, "Read status")
+	t.L(LogDebug, "Read status")
 	// Read query status
 	status, err := t.readInt32()
 	if err != nil {
@@ -361,17 +494,60 @@ func (s *session) executeQueryUpdate(stmt *h2stmt, t *transfer, values []driver.
 	if err != nil {
 		return -1, err
 	}
-	L(log.DebugLevel, "Status: %d - Num updated: %d - Autocommit: %v", status, nUpdated, autoCommit)
+	t.L(LogDebug, "Status: %d - Num updated: %d - Autocommit: %v", status, nUpdated, autoCommit)
 	return nUpdated, nil
 }
 
+func (s *session) writeParameters(stmt *h2stmt, t *transfer, values []driver.Value) error {
+	var err error
+	// -- num parameters
+	err = t.writeInt32(int32(len(values)))
+	if err != nil {
+		return err
+	}
+	// -- parameters
+	for idx, value := range values {
+		err = s.writeParameter(t, value, stmt.parameter(idx))
+		if err != nil {
+			return errors.Wrapf(err, "can't write parameter %d", idx+1)
+		}
+	}
+	return nil
+}
+
+// writeParameter writes a value with the type declared for the parameter
+func (s *session) writeParameter(t *transfer, value driver.Value, param h2parameter) error {
+	switch v := value.(type) {
+	case nil:
+		if param.nullable == columnNoNulls {
+			return errors.Errorf("NULL not allowed")
+		}
+		// The protocol has a single NULL for all the types (as the JDBC setNull sends): the server
+		// converts it to the declared type of the parameter
+		return t.writeNullValue()
+	case time.Time:
+		return t.writeDatetimeValue(v, param)
+	case *Lob:
+		return t.writeValue(v)
+	case io.Reader:
+		return t.writeReaderValue(v, param.isText())
+	}
+	return t.writeValue(value)
+}
+
 func (s *session) prepare2(t *transfer, sql string) (driver.Stmt, error) {
+	return s.prepareAs(t, s.getNextID(), sql)
+}
+
+// prepareAs prepares a statement with a given ID, as in all the nodes of a cluster
+func (s *session) prepareAs(t *transfer, id int32, sql string) (driver.Stmt, error) {
 	var err error
 	stmt := h2stmt{}
 	// 0. Write SESSION_PREPARE
+	t.stats.command(sessionPrepareReadParams2)
 	err = t.writeInt32(sessionPrepareReadParams2)
 	// 1. Write ID
-	stmt.id = s.getNextID()
+	stmt.id = id
 	err = t.writeInt32(stmt.id)
 	if err != nil {
 		return stmt, err
@@ -396,6 +572,7 @@ func (s *session) prepare2(t *transfer, sql string) (driver.Stmt, error) {
 	if err != nil {
 		return stmt, err
 	}
+	t.stats.add(statOpenStatements, 1)
 
 	// 6. Read Is Query
 	isQuery, err := t.readBool()
@@ -412,13 +589,13 @@ func (s *session) prepare2(t *transfer, sql string) (driver.Stmt, error) {
 	if err != nil {
 		return stmt, err
 	}
-	L(log.DebugLevel, "CMD type: %d", cmdType)
+	t.L(LogDebug, "CMD type: %d", cmdType)
 	// 8. Read params size
 	numParams, err := t.readInt32()
 	if err != nil {
 		return stmt, err
 	}
-	L(log.DebugLevel, "STATUS: %d, IsQuery: %v, Is Read-Only: %v, Num Params: %d", state, isQuery, isRO, numParams)
+	t.L(LogDebug, "STATUS: %d, IsQuery: %v, Is Read-Only: %v, Num Params: %d", state, isQuery, isRO, numParams)
 	stmt.isQuery = isQuery
 	stmt.isRO = isRO
 	stmt.numParams = numParams
@@ -441,14 +618,12 @@ func (s *session) prepare2(t *transfer, sql string) (driver.Stmt, error) {
 		if err != nil {
 			return nil, err
 		}
-		// -- Nullable
-		tmp, err := t.readInt32()
+		// -- Nullable: 0 = Not null, 1 == Nullable, 2 == Unknown
+		param.nullable, err = t.readInt32()
 		if err != nil {
 			return nil, err
 		}
-		// 0 = Not null, 1 == Nullable, 2 == Unknown
-		param.nullable = tmp == 1
-		L(log.DebugLevel, "PARAM: Kind: %d - Precission: %d - Scale: %d - Nullable: %v", param.kind, param.precission, param.scale, param.nullable)
+		t.L(LogDebug, "PARAM: Kind: %d - Precission: %d - Scale: %d - Nullable: %d", param.kind, param.precission, param.scale, param.nullable)
 		stmt.parameters = append(stmt.parameters, param)
 	}
 	return stmt, nil
@@ -457,6 +632,7 @@ func (s *session) prepare2(t *transfer, sql string) (driver.Stmt, error) {
 func (s *session) close(t *transfer) error {
 	var err error
 	// 0. Write SESSION_CLOSE
+	t.stats.command(sessionClose)
 	err = t.writeInt32(sessionClose)
 	if err != nil {
 		return err
@@ -470,7 +646,7 @@ func (s *session) close(t *transfer) error {
 	if err != nil {
 		return err
 	}
-	L(log.DebugLevel, "Status: %d", status)
+	t.L(LogDebug, "Status: %d", status)
 	t.close()
 	return nil
 }
@@ -0,0 +1,156 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"expvar"
+	"net"
+	"sync/atomic"
+)
+
+// Stats are the counters of the connections of a connector, or of all of them
+type Stats struct {
+	BytesIn  int64
+	BytesOut int64
+	// Requests waiting for a server response
+	RoundTrips int64
+	// Commands sent by type: prepare, executeQuery, executeUpdate, fetchRows, ...
+	Commands map[string]int64
+	// SQL errors returned by the server
+	Errors int64
+	// Statements prepared on the server and not closed yet
+	OpenStatements int64
+	// Query results on the server not closed yet
+	OpenResults int64
+	// Operations not started because their context was done
+	Cancels int64
+	// Connections that failed to open or to answer a ping
+	BadConns int64
+}
+
+// TotalStats gets the counters of all the connections
+func TotalStats() Stats {
+	return totalStats.snapshot()
+}
+
+// Helpers
+
+const (
+	statBytesIn = iota
+	statBytesOut
+	statRoundTrips
+	statErrors
+	statOpenStatements
+	statOpenResults
+	statCancels
+	statBadConns
+	// One counter per command type from here
+	statCommands
+)
+
+var statNames = []string{"bytesIn", "bytesOut", "roundTrips", "errors", "openStatements", "openResults", "cancels", "badConns"}
+
+var commandNames = map[int]string{
+	sessionPrepare:              "prepare",
+	sessionClose:                "close",
+	sessionCommandExecuteQuery:  "executeQuery",
+	sessionCommandExecuteUpdate: "executeUpdate",
+	sessionCommandClose:         "closeCommand",
+	sessionCommandCommit:        "commit",
+	sessionResultFetchRows:      "fetchRows",
+	sessionResultClose:          "closeResult",
+	sessionLobRead:              "lobRead",
+	sessionPrepareReadParams2:   "prepareReadParams",
+}
+
+// stats counts the activity of a connector; also added to its parent
+type stats struct {
+	// First for the alignment of atomic operations
+	counters [statCommands + sessionPrepareReadParams2 + 1]int64
+	parent   *stats
+}
+
+var totalStats = &stats{}
+
+func init() {
+	m := expvar.NewMap("h2go")
+	for i, name := range statNames {
+		counter := i
+		m.Set(name, expvar.Func(func() interface{} {
+			return atomic.LoadInt64(&totalStats.counters[counter])
+		}))
+	}
+	m.Set("commands", expvar.Func(func() interface{} {
+		return totalStats.snapshot().Commands
+	}))
+}
+
+func newStats() *stats {
+	return &stats{parent: totalStats}
+}
+
+func (s *stats) add(counter int, delta int64) {
+	for ; s != nil; s = s.parent {
+		atomic.AddInt64(&s.counters[counter], delta)
+	}
+}
+
+// command counts a command sent to the server
+func (s *stats) command(cmd int) {
+	s.add(statCommands+cmd, 1)
+}
+
+func (s *stats) snapshot() Stats {
+	get := func(counter int) int64 {
+		return atomic.LoadInt64(&s.counters[counter])
+	}
+	st := Stats{
+		BytesIn:        get(statBytesIn),
+		BytesOut:       get(statBytesOut),
+		RoundTrips:     get(statRoundTrips),
+		Commands:       map[string]int64{},
+		Errors:         get(statErrors),
+		OpenStatements: get(statOpenStatements),
+		OpenResults:    get(statOpenResults),
+		Cancels:        get(statCancels),
+		BadConns:       get(statBadConns),
+	}
+	for cmd, name := range commandNames {
+		if n := get(statCommands + cmd); n != 0 {
+			st.Commands[name] = n
+		}
+	}
+	return st
+}
+
+// statsConn counts the bytes read and written
+type statsConn struct {
+	net.Conn
+	stats *stats
+}
+
+func (c *statsConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.stats.add(statBytesIn, int64(n))
+	return n, err
+}
+
+func (c *statsConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.stats.add(statBytesOut, int64(n))
+	return n, err
+}
@@ -19,6 +19,8 @@ package h2go
 import (
 	"context"
 	"database/sql/driver"
+
+	"github.com/pkg/errors"
 )
 
 type h2stmt struct {
@@ -28,49 +30,182 @@ type h2stmt struct {
 	isRO       bool
 	numParams  int32
 	parameters []h2parameter
-	client     h2client
+	client     *h2client
 	query      string
+	// Names of the named parameters, in parameter order
+	names []string
+	// The query has @name placeholders, run rewritten if bound to named arguments
+	atNames *namedStmt
 	// Interfaces
 	driver.Stmt
 	driver.StmtQueryContext
 	driver.StmtExecContext
+	driver.NamedValueChecker
 }
 
 type h2parameter struct {
 	kind       int32
 	precission int64
 	scale      int32
-	nullable   bool
+	nullable   int32
 }
 
 // Interface Stmt
 func (h2s h2stmt) Close() error {
-	// TODO: check for action
-	return nil
+	// Free the statement on the server, and the rewritten one of @name placeholders
+	if h2s.atNames != nil && h2s.atNames.stmt != nil {
+		err := h2s.atNames.stmt.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return h2s.client.closeCommand(h2s.id)
 }
 
 func (h2s h2stmt) NumInput() int {
+	if h2s.names != nil || h2s.atNames != nil {
+		// Named arguments are checked when bound
+		return -1
+	}
 	return int(h2s.numParams)
 }
 
+// Interface NamedValueChecker
+func (h2s h2stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	err := checkNamedValue(nv)
+	if err != nil {
+		return err
+	}
+	if idx := h2s.paramIndex(nv); idx >= 0 && idx < len(h2s.parameters) {
+		nv.Value, err = h2s.parameters[idx].coerce(nv.Value)
+		if err != nil {
+			return errors.Wrapf(err, "can't convert parameter %d", nv.Ordinal)
+		}
+		// Checked before sending the statement
+		if nv.Value == nil && h2s.parameters[idx].nullable == columnNoNulls {
+			return errors.Errorf("parameter %d can't be NULL: it's declared NOT NULL", nv.Ordinal)
+		}
+	}
+	return nil
+}
+
 // Interface StmtQueryContext
 func (h2s h2stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	cols, nRows, err := h2s.client.sess.executeQuery(&h2s, &h2s.client.trans)
+	if h2s.atNames != nil && hasNamedArgs(args) {
+		st, err := h2s.atNames.prepare(ctx, h2s)
+		if err != nil {
+			return nil, err
+		}
+		return st.QueryContext(ctx, args)
+	}
+	err := h2s.client.checkContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &h2Result{query: h2s.query, columns: cols, numRows: nRows, trans: &h2s.client.trans, curRow: 0}, nil
+	hc := startHook(ctx, h2s.client.hook, OpQuery, h2s.query, len(args))
+	argsValues, err := h2s.bindValues(args)
+	if err != nil {
+		hc.end(0, err)
+		return nil, err
+	}
+	res, err := h2s.client.sess.executeQuery(&h2s, &h2s.client.trans, argsValues)
+	if err != nil {
+		hc.end(0, err)
+		return nil, err
+	}
+	res.query = h2s.query
+	res.client = h2s.client
+	res.ctx = hc.context(ctx)
+	hc.end(int64(len(res.rows)), nil)
+	return res, nil
 }
 
 // Interface StmtExecContext
 func (h2s h2stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if h2s.atNames != nil && hasNamedArgs(args) {
+		st, err := h2s.atNames.prepare(ctx, h2s)
+		if err != nil {
+			return nil, err
+		}
+		return st.ExecContext(ctx, args)
+	}
+	err := h2s.client.checkContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hc := startHook(ctx, h2s.client.hook, OpExec, h2s.query, len(args))
+	argsValues, err := h2s.bindValues(args)
+	if err != nil {
+		hc.end(0, err)
+		return nil, err
+	}
+	nUpdated, err := h2s.client.executeUpdate(&h2s, argsValues)
+	if err != nil {
+		hc.end(0, err)
+		return nil, err
+	}
+	hc.end(int64(nUpdated), nil)
+	return &h2ExecResult{nUpdated: nUpdated}, nil
+}
+
+// Helpers
+
+// bindValues gets the values of the arguments coerced to the parameter types declared by the server
+func (h2s h2stmt) bindValues(args []driver.NamedValue) ([]driver.Value, error) {
 	var argsValues []driver.Value
+	if h2s.names != nil {
+		var err error
+		args, err = namedQuery{names: h2s.names}.bind(args)
+		if err != nil {
+			return nil, err
+		}
+	}
 	for _, arg := range args {
+		err := h2s.CheckNamedValue(&arg)
+		if err != nil {
+			return nil, err
+		}
 		argsValues = append(argsValues, arg.Value)
 	}
-	nUpdated, err := h2s.client.sess.executeQueryUpdate(&h2s, &h2s.client.trans, argsValues)
+	return argsValues, nil
+}
+
+// parameter gets the metadata of a parameter, with unknown type if the server didn't send it
+func (h2s h2stmt) parameter(idx int) h2parameter {
+	if idx >= 0 && idx < len(h2s.parameters) {
+		return h2s.parameters[idx]
+	}
+	return h2parameter{kind: typeUnknown, nullable: columnNullableUnknown}
+}
+
+// paramIndex gets the index of the parameter an argument is bound to
+func (h2s h2stmt) paramIndex(nv *driver.NamedValue) int {
+	if nv.Name != "" {
+		return namedQuery{names: h2s.names}.indexOf(nv.Name)
+	}
+	return nv.Ordinal - 1
+}
+
+// namedStmt is the rewritten statement of a query with @name placeholders. It's prepared the first
+// time the query runs with named arguments and reused from then on.
+type namedStmt struct {
+	nq   namedQuery
+	stmt *h2stmt
+}
+
+func (ns *namedStmt) prepare(ctx context.Context, h2s h2stmt) (*h2stmt, error) {
+	if ns.stmt != nil {
+		return ns.stmt, nil
+	}
+	hc := startHook(ctx, h2s.client.hook, OpPrepare, h2s.query, 0)
+	st, err := h2s.client.prepareAll(ns.nq.query)
+	hc.end(0, err)
 	if err != nil {
 		return nil, err
 	}
-	return &h2ExecResult{nUpdated: nUpdated}, nil
+	st.client = h2s.client
+	st.query = h2s.query
+	st.names = ns.nq.names
+	ns.stmt = &st
+	return ns.stmt, nil
 }
@@ -18,54 +18,137 @@ package h2go
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"math/bits"
 	"net"
+	"strconv"
+	"strings"
 	"time"
-	"unsafe"
 
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 	"golang.org/x/text/encoding/unicode"
 )
 
 // Value types
 const (
-	Null             int32 = 0
-	Boolean          int32 = 1
-	Byte             int32 = 2
-	Short            int32 = 3
-	Int              int32 = 4
-	Long             int32 = 5
-	Decimal          int32 = 6
-	Double           int32 = 7
-	Float            int32 = 8
-	Time             int32 = 9
-	Date             int32 = 10
-	Timestamp        int32 = 11
-	Bytes            int32 = 12
-	String           int32 = 13
-	StringIgnoreCase int32 = 14
-	Blob             int32 = 15
-	Clob             int32 = 16
-	Array            int32 = 17
-	ResultSet        int32 = 18
-	JavaObject       int32 = 19
-	UUID             int32 = 20
-	StringFixed      int32 = 21
-	Geometry         int32 = 22
-	TimestampTZ      int32 = 24
-	Enum             int32 = 25
-	Interval         int32 = 26
-	Row              int32 = 27
-	JSON             int32 = 28
-	TimeTZQuery      int32 = 29
-	TimeTZ           int32 = 41
+	ValueNull             int32 = 0
+	ValueBoolean          int32 = 1
+	ValueByte             int32 = 2
+	ValueShort            int32 = 3
+	ValueInt              int32 = 4
+	ValueLong             int32 = 5
+	ValueDecimal          int32 = 6
+	ValueDouble           int32 = 7
+	ValueFloat            int32 = 8
+	ValueTime             int32 = 9
+	ValueDate             int32 = 10
+	ValueTimestamp        int32 = 11
+	ValueBytes            int32 = 12
+	ValueString           int32 = 13
+	ValueStringIgnoreCase int32 = 14
+	ValueBlob             int32 = 15
+	ValueClob             int32 = 16
+	ValueArray            int32 = 17
+	ValueResultSet        int32 = 18
+	ValueJavaObject       int32 = 19
+	ValueUUID             int32 = 20
+	ValueStringFixed      int32 = 21
+	ValueGeometry         int32 = 22
+	ValueTimestampTZ      int32 = 24
+	ValueEnum             int32 = 25
+	ValueInterval         int32 = 26
+	ValueRow              int32 = 27
+	ValueJSON             int32 = 28
+	ValueTimeTZQuery      int32 = 29
+	ValueTimeTZ           int32 = 41
+)
+
+// Former names of the value types. Decimal, Date, Array, ResultSet, JavaObject, UUID, Geometry,
+// Enum, Interval, Row and JSON are left out: they are the names of the driver types.
+const (
+	// Deprecated: use ValueNull
+	Null = ValueNull
+	// Deprecated: use ValueBoolean
+	Boolean = ValueBoolean
+	// Deprecated: use ValueByte
+	Byte = ValueByte
+	// Deprecated: use ValueShort
+	Short = ValueShort
+	// Deprecated: use ValueInt
+	Int = ValueInt
+	// Deprecated: use ValueLong
+	Long = ValueLong
+	// Deprecated: use ValueDouble
+	Double = ValueDouble
+	// Deprecated: use ValueFloat
+	Float = ValueFloat
+	// Deprecated: use ValueTime
+	Time = ValueTime
+	// Deprecated: use ValueTimestamp
+	Timestamp = ValueTimestamp
+	// Deprecated: use ValueBytes
+	Bytes = ValueBytes
+	// Deprecated: use ValueString
+	String = ValueString
+	// Deprecated: use ValueStringIgnoreCase
+	StringIgnoreCase = ValueStringIgnoreCase
+	// Deprecated: use ValueBlob
+	Blob = ValueBlob
+	// Deprecated: use ValueClob
+	Clob = ValueClob
+	// Deprecated: use ValueStringFixed
+	StringFixed = ValueStringFixed
+	// Deprecated: use ValueTimestampTZ
+	TimestampTZ = ValueTimestampTZ
+	// Deprecated: use ValueTimeTZQuery
+	TimeTZQuery = ValueTimeTZQuery
+	// Deprecated: use ValueTimeTZ
+	TimeTZ = ValueTimeTZ
+)
+
+// Data types of parameter and column metadata that differ from the value types
+const (
+	typeUnknown                int32 = -1
+	typeIntervalYear           int32 = 26
+	typeIntervalMonth          int32 = 27
+	typeIntervalDay            int32 = 28
+	typeIntervalHour           int32 = 29
+	typeIntervalMinute         int32 = 30
+	typeIntervalSecond         int32 = 31
+	typeIntervalYearToMonth    int32 = 32
+	typeIntervalDayToHour      int32 = 33
+	typeIntervalDayToMinute    int32 = 34
+	typeIntervalDayToSecond    int32 = 35
+	typeIntervalHourToMinute   int32 = 36
+	typeIntervalHourToSecond   int32 = 37
+	typeIntervalMinuteToSecond int32 = 38
+	typeRow                    int32 = 39
+	typeJSON                   int32 = 40
 )
 
 type transfer struct {
 	conn net.Conn
 	buff *bufio.ReadWriter
+	// Protocol version agreed in the handshake
+	version int32
+	// Return ENUM values as Enum instead of their labels
+	enumOrdinals bool
+	// Return DATE, TIME and TIMESTAMP as Date, TimeOfDay and LocalDateTime
+	civil bool
+	// Return big LOBs as *Lob instead of reading them
+	streamLobs bool
+	// Location of TIMESTAMP values (without time zone); nil to send the wall clock of the values and read them as UTC
+	loc *time.Location
+	// Logger of the connection, nil for none
+	*logger
+	// Counters of the connector
+	stats *stats
 }
 
 func newTransfer(conn net.Conn) transfer {
@@ -76,6 +159,13 @@ func newTransfer(conn net.Conn) transfer {
 	return transfer{conn: conn, buff: buff}
 }
 
+func (t *transfer) location() *time.Location {
+	if t.loc == nil {
+		return time.UTC
+	}
+	return t.loc
+}
+
 func (t *transfer) readInt32() (int32, error) {
 	var ret int32
 	err := binary.Read(t.buff, binary.BigEndian, &ret)
@@ -125,6 +215,10 @@ func (t *transfer) writeInt32(v int32) error {
 func (t *transfer) writeInt64(v int64) error {
 	return binary.Write(t.buff, binary.BigEndian, v)
 }
+
+func (t *transfer) writeFloat32(v float32) error {
+	return binary.Write(t.buff, binary.BigEndian, v)
+}
 func (t *transfer) writeFloat64(v float64) error {
 	return binary.Write(t.buff, binary.BigEndian, v)
 }
@@ -139,25 +233,9 @@ func (t *transfer) readString() (string, error) {
 		return "", nil
 	}
 	buf := make([]byte, n*2)
-	/*
-		var cur int32
-		for {
-			n2, err := t.buff.Read(buf[cur:n])
-			if err != nil {
-				return "", err
-			}
-			cur += int32(n2)
-			if cur == n {
-				break
-			}
-		}
-	*/
-	n2, err := t.buff.Read(buf)
+	_, err = io.ReadFull(t.buff, buf)
 	if err != nil {
-		return "", err
-	}
-	if n2 != len(buf) {
-		return "", errors.Errorf("Can't read all data needed")
+		return "", errors.Wrapf(err, "Can't read all data needed")
 	}
 	dec := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder()
 	buf, err = dec.Bytes(buf)
@@ -170,36 +248,19 @@ func (t *transfer) readString() (string, error) {
 
 func (t *transfer) writeString(s string) error {
 	var err error
-	data := []byte(s)
-	n := int32(len(data))
-	if n == 0 {
-		n = -1
+	enc := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewEncoder()
+	data, err := enc.Bytes([]byte(s))
+	if err != nil {
+		return errors.Wrapf(err, "can't convert to UTF-16")
 	}
-	err = t.writeInt32(n)
+	// Length is sent in UTF-16 units, not in bytes
+	err = t.writeInt32(int32(len(data) / 2))
 	if err != nil {
 		return errors.Wrapf(err, "can't write string length to socket")
 	}
-	if n == -1 {
+	if len(data) == 0 {
 		return nil
 	}
-	enc := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewEncoder()
-	data, err = enc.Bytes(data)
-	if err != nil {
-		return errors.Wrapf(err, "can't convert to UTF-16")
-	}
-	/*
-		n = int32(len(data))
-		for {
-			n2, err := t.buff.Write(data[pos:n])
-			if err != nil {
-				return errors.Wrapf(err, "can't write string to socket")
-			}
-			pos += int32(n2)
-			if pos == n {
-				break
-			}
-		}
-	*/
 	n2, err := t.buff.Write(data)
 	if err != nil {
 		return errors.Wrapf(err, "can't write string to socket")
@@ -286,6 +347,34 @@ func (t *transfer) readDate() (time.Time, error) {
 	return date, nil
 }
 
+func (t *transfer) readCivilDate() (Date, error) {
+	n, err := t.readInt64()
+	if err != nil {
+		return Date{}, err
+	}
+	return dateFromValue(n), nil
+}
+
+func (t *transfer) readTimeOfDay() (TimeOfDay, error) {
+	n, err := t.readInt64()
+	if err != nil {
+		return TimeOfDay{}, err
+	}
+	return timeOfDayFromNanos(n), nil
+}
+
+func (t *transfer) readLocalDateTime() (LocalDateTime, error) {
+	d, err := t.readCivilDate()
+	if err != nil {
+		return LocalDateTime{}, err
+	}
+	tod, err := t.readTimeOfDay()
+	if err != nil {
+		return LocalDateTime{}, err
+	}
+	return LocalDateTime{Date: d, Time: tod}, nil
+}
+
 func (t *transfer) readTimestamp() (time.Time, error) {
 	nDate, err := t.readInt64()
 	if err != nil {
@@ -295,7 +384,7 @@ func (t *transfer) readTimestamp() (time.Time, error) {
 	if err != nil {
 		return time.Time{}, err
 	}
-	date := bin2ts(nDate, nNsecs)
+	date := bin2ts(nDate, nNsecs, t.location())
 	return date, nil
 }
 
@@ -316,7 +405,211 @@ func (t *transfer) readTimestampTZ() (time.Time, error) {
 	return date, nil
 }
 
+func (t *transfer) readDecimal() (Decimal, error) {
+	// Decimals travel as text
+	s, err := t.readString()
+	if err != nil {
+		return Decimal{}, err
+	}
+	return ParseDecimal(s)
+}
+
+func (t *transfer) readUUID() (UUID, error) {
+	high, err := t.readInt64()
+	if err != nil {
+		return UUID{}, err
+	}
+	low, err := t.readInt64()
+	if err != nil {
+		return UUID{}, err
+	}
+	return uuidFromHalves(high, low), nil
+}
+
+func (t *transfer) readInterval() (interface{}, error) {
+	ordinal, err := t.readByte()
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read interval qualifier")
+	}
+	// Negative intervals have the qualifier complemented
+	qualifier := int8(ordinal)
+	negative := qualifier < 0
+	if negative {
+		qualifier = ^qualifier
+	}
+	leading, err := t.readInt64()
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read interval leading field")
+	}
+	var remaining int64
+	if qualifier >= intervalSecond {
+		remaining, err = t.readInt64()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read interval remaining field")
+		}
+	}
+	return newInterval(qualifier, negative, leading, remaining)
+}
+
+// readLob reads a LOB: small ones come inline and others as a reference to read them with LOB READ
+func (t *transfer) readLob(kind int32) (interface{}, error) {
+	length, err := t.readInt64()
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read LOB length")
+	}
+	if length == -1 {
+		lob := &Lob{kind: kind}
+		lob.tableID, err = t.readInt32()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read LOB table ID")
+		}
+		lob.lobID, err = t.readInt64()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read LOB ID")
+		}
+		if t.version >= 12 {
+			lob.hmac, err = t.readBytes()
+			if err != nil {
+				return nil, errors.Wrapf(err, "can't read LOB HMAC")
+			}
+		}
+		lob.precision, err = t.readInt64()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read LOB precision")
+		}
+		return lob, nil
+	}
+	if length < 0 || length > math.MaxInt32 {
+		return nil, errors.Errorf("invalid LOB length: %d", length)
+	}
+	var v interface{}
+	if kind == ValueClob {
+		v, err = readChars(t.buff, length)
+	} else {
+		v, err = t.readBytesDef(int(length))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read LOB data")
+	}
+	magic, err := t.readInt32()
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read LOB end")
+	}
+	if magic != lobMagic {
+		return nil, errors.Errorf("invalid LOB end: %x", magic)
+	}
+	return v, nil
+}
+
+func (t *transfer) readArray() ([]interface{}, error) {
+	n, err := t.readInt32()
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read array length")
+	}
+	if n < 0 {
+		// Typed array: the Java component class is sent
+		n = -(n + 1)
+		_, err = t.readString()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read array component type")
+		}
+	}
+	list := make([]interface{}, n)
+	for i := range list {
+		list[i], err = t.readValue()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read array element %d", i)
+		}
+	}
+	return list, nil
+}
+
+func (t *transfer) readRow() (Row, error) {
+	values, err := t.readArray()
+	if err != nil {
+		return Row{}, errors.Wrapf(err, "can't read row")
+	}
+	return newRow(values), nil
+}
+
+func (t *transfer) readResultSet() (*ResultSet, error) {
+	colCnt, err := t.readInt32()
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read result set columns")
+	}
+	rs := &ResultSet{}
+	for i := 0; i < int(colCnt); i++ {
+		col, err := t.readResultSetColumn()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read result set column %d", i)
+		}
+		rs.columns = append(rs.columns, col)
+	}
+	for {
+		next, err := t.readBool()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read result set row")
+		}
+		if !next {
+			break
+		}
+		row := make([]interface{}, colCnt)
+		for i := range row {
+			row[i], err = t.readValue()
+			if err != nil {
+				return nil, errors.Wrapf(err, "can't read result set value")
+			}
+		}
+		rs.rows = append(rs.rows, row)
+	}
+	return rs, nil
+}
+
+func (t *transfer) readResultSetColumn() (string, error) {
+	if t.version < 18 {
+		// Name - SQL type (int) - Precision (int) - Scale (int)
+		name, err := t.readString()
+		if err != nil {
+			return "", err
+		}
+		for i := 0; i < 3; i++ {
+			_, err = t.readInt32()
+			if err != nil {
+				return "", err
+			}
+		}
+		return name, nil
+	}
+	// Alias - Name - Type (int) - Precision (long) - Scale (int)
+	alias, err := t.readString()
+	if err != nil {
+		return "", err
+	}
+	name, err := t.readString()
+	if err != nil {
+		return "", err
+	}
+	_, err = t.readInt32()
+	if err != nil {
+		return "", err
+	}
+	_, err = t.readLong()
+	if err != nil {
+		return "", err
+	}
+	_, err = t.readInt32()
+	if err != nil {
+		return "", err
+	}
+	if alias != "" {
+		return alias, nil
+	}
+	return name, nil
+}
+
 func (t *transfer) flush() error {
+	// A response is expected after each flush
+	t.stats.add(statRoundTrips, 1)
 	return t.buff.Flush()
 }
 
@@ -326,185 +619,576 @@ func (t *transfer) readValue() (interface{}, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "can't read type of value")
 	}
-	L(log.DebugLevel, "Value type: %d", kind)
+	t.L(LogDebug, "Value type: %d", kind)
 	switch kind {
-	case Null:
+	case ValueNull:
 		// TODO: review
 		return nil, nil
-	case Bytes:
+	case ValueBytes:
 		return t.readBytes()
-	case UUID:
-		return nil, errors.Errorf("UUID not implemented")
-	case JavaObject:
-		return nil, errors.Errorf("Java Object not implemented")
-	case Boolean:
+	case ValueUUID:
+		u, err := t.readUUID()
+		if err != nil {
+			return nil, err
+		}
+		return u.String(), nil
+	case ValueJavaObject:
+		// Serialized object
+		data, err := t.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return JavaObject(data), nil
+	case ValueBoolean:
 		return t.readBool()
-	case Byte:
+	case ValueByte:
 		return t.readByte()
-	case Date:
+	case ValueDate:
+		if t.civil {
+			return t.readCivilDate()
+		}
 		return t.readDate()
-	case Time:
+	case ValueTime:
+		if t.civil {
+			return t.readTimeOfDay()
+		}
 		return t.readTime()
-	case TimeTZQuery, TimeTZ:
+	case ValueTimeTZQuery, ValueTimeTZ:
 		return t.readTimeTZ()
-	case Timestamp:
+	case ValueTimestamp:
+		if t.civil {
+			return t.readLocalDateTime()
+		}
 		return t.readTimestamp()
-	case TimestampTZ:
+	case ValueTimestampTZ:
 		return t.readTimestampTZ()
-	case Decimal:
-		return nil, errors.Errorf("Decimal not implemented")
-	case Double:
+	case ValueDecimal:
+		d, err := t.readDecimal()
+		if err != nil {
+			return nil, err
+		}
+		return d.String(), nil
+	case ValueDouble:
 		return t.readFloat64()
-	case Float:
+	case ValueFloat:
 		return t.readFloat32()
-	case Enum:
-		return nil, errors.Errorf("Enum not implemented")
-	case Int:
+	case ValueEnum:
+		// Ordinal and label: the ordinal is the index of the label in the ENUM values
+		ordinal, err := t.readInt32()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read enum ordinal")
+		}
+		label, err := t.readString()
+		if err != nil || !t.enumOrdinals {
+			return label, err
+		}
+		return Enum{Label: label, Ordinal: int(ordinal)}, nil
+	case ValueInt:
 		return t.readInt32()
-	case Long:
+	case ValueLong:
 		return t.readLong()
-	case Short:
+	case ValueShort:
 		return t.readInt16()
-	case String:
+	case ValueString:
 		return t.readString()
-	case StringIgnoreCase:
+	case ValueStringIgnoreCase:
 		return t.readString()
-	case StringFixed:
+	case ValueStringFixed:
 		return t.readString()
-	case Blob:
-		return nil, errors.Errorf("Blob not implemented")
-	case Clob:
-		return nil, errors.Errorf("Clob not implemented")
-	case Array:
-		return nil, errors.Errorf("Array not implemented")
-	case Row:
-		return nil, errors.Errorf("Row not implemented")
-	case ResultSet:
-		return nil, errors.Errorf("Result Set not implemented")
-	case Geometry:
-		return nil, errors.Errorf("Geometry not implemented")
-	case JSON:
-		return nil, errors.Errorf("JSON not implemented")
+	case ValueBlob, ValueClob:
+		return t.readLob(kind)
+	case ValueArray:
+		return t.readArray()
+	case ValueRow:
+		return t.readRow()
+	case ValueResultSet:
+		return t.readResultSet()
+	case ValueGeometry:
+		// EWKB
+		data, err := t.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return Geometry(data), nil
+	case ValueJSON:
+		// JSON text in UTF-8
+		return t.readBytes()
+	case ValueInterval:
+		return t.readInterval()
 	default:
-		L(log.ErrorLevel, "Unknown type: %d", kind)
+		t.L(LogError, "Unknown type: %d", kind)
 		return nil, errors.Errorf("Unknown type: %d", kind)
 	}
 
 }
 
 func (t *transfer) writeValue(v interface{}) error {
-	switch kind := v.(type) {
+	switch v := v.(type) {
 	case nil:
-		t.writeInt32(Null)
+		return t.writeNullValue()
 	case bool:
-		t.writeInt32(Boolean)
-		t.writeBool(v.(bool))
-	case int:
-		s := unsafe.Sizeof(v)
-		if s == 4 {
-			t.writeInt32(Int)
-			t.writeInt32(int32(v.(int)))
-		} else {
-			// 8 bytes
-			t.writeInt32(Long)
-			t.writeInt64(int64(v.(int)))
-		}
+		return t.writeBoolValue(v)
+	case int8:
+		return t.writeByteValue(v)
 	case int16:
-		t.writeInt32(Short)
-		t.writeInt32(v.(int32))
+		return t.writeShortValue(v)
 	case int32:
-		t.writeInt32(Int)
-		t.writeInt32(int32(v.(int32)))
+		return t.writeIntValue(v)
 	case int64:
-		t.writeInt32(Long)
-		t.writeInt64(int64(v.(int64)))
+		return t.writeLongValue(v)
+	case int:
+		if bits.UintSize == 32 {
+			return t.writeIntValue(int32(v))
+		}
+		return t.writeLongValue(int64(v))
+	// Unsigned integers are widened to the next signed H2 type
+	case uint8:
+		return t.writeShortValue(int16(v))
+	case uint16:
+		return t.writeIntValue(int32(v))
+	case uint32:
+		return t.writeLongValue(int64(v))
+	case uint:
+		return t.writeUnsignedValue(uint64(v))
+	case uint64:
+		return t.writeUnsignedValue(v)
+	case float32:
+		return t.writeFloatValue(v)
 	case float64:
-		t.writeInt32(Double)
-		t.writeFloat64(v.(float64))
+		return t.writeDoubleValue(v)
 	case string:
-		t.writeInt32(String)
-		t.writeString(v.(string))
-	case byte:
-		t.writeInt32(Byte)
-		t.writeByte(v.(byte))
+		return t.writeStringValue(v)
 	case []byte:
-		t.writeInt32(Bytes)
-		t.writeBytes(v.([]byte))
-	// case time.Time:
+		return t.writeBytesValue(v)
+	case *big.Int:
+		return t.writeBigIntValue(v)
+	case Decimal:
+		return t.writeDecimalValue(v)
+	case UUID:
+		return t.writeUUIDValue(v)
+	case json.RawMessage:
+		return t.writeJSONValue(v)
+	case *big.Rat:
+		d, err := ratToDecimal(v)
+		if err != nil {
+			return err
+		}
+		return t.writeDecimalValue(d)
+	case []interface{}:
+		return t.writeArrayValue(v)
+	case Geometry:
+		return t.writeGeometryValue(v)
+	case JavaObject:
+		return t.writeJavaObjectValue(v)
+	case time.Time:
+		return t.writeTimestampTZValue(v)
+	case Date:
+		return t.writeCivilValue(ValueDate, v.dateValue(), 0)
+	case TimeOfDay:
+		return t.writeCivilValue(ValueTime, v.nanos(), 0)
+	case LocalDateTime:
+		return t.writeCivilValue(ValueTimestamp, v.Date.dateValue(), v.Time.nanos())
+	case *Lob:
+		return t.writeLobValue(v)
+	case io.Reader:
+		return t.writeReaderValue(v, false)
+	case time.Duration:
+		return t.writeDurationValue(v)
+	case Interval:
+		return t.writeIntervalValue(v)
 	default:
-		return fmt.Errorf("Can't convert type %T to H2 Type", kind)
+		return errors.Errorf("can't convert type %T to H2 type", v)
 	}
-	return nil
 }
+
 func (t *transfer) writeDatetimeValue(dt time.Time, mdp h2parameter) error {
-	L(log.DebugLevel, "Date/time type: %d", mdp.kind)
-	var err error
+	t.L(LogDebug, "Date/time type: %d", mdp.kind)
 	switch mdp.kind {
-	case Date:
-		t.writeInt32(Date)
-		bin := date2bin(&dt)
-		err = t.writeInt64(bin)
-		if err != nil {
-			return err
-		}
-	case Timestamp:
-		t.writeInt32(Timestamp)
-		dateBin, nsecBin := ts2bin(&dt)
-		err = t.writeInt64(dateBin)
-		if err != nil {
-			return err
-		}
-		err = t.writeInt64(nsecBin)
-		if err != nil {
-			return err
-		}
-	case TimestampTZ:
-		t.writeInt32(TimestampTZ)
-		dateBin, nsecBin, offsetTZBin := tsz2bin(&dt)
-		err = t.writeInt64(dateBin)
-		if err != nil {
-			return err
-		}
-		err = t.writeInt64(nsecBin)
-		if err != nil {
-			return err
-		}
-		err = t.writeInt32(offsetTZBin)
+	case ValueDate:
+		return t.writeDateValue(dt)
+	case ValueTimestamp:
+		return t.writeTimestampValue(dt)
+	case ValueTimestampTZ:
+		return t.writeTimestampTZValue(dt)
+	case ValueTime:
+		return t.writeTimeValue(dt)
+	case ValueTimeTZ:
+		return t.writeTimeTZValue(dt)
+	default:
+		// Unknown or other types: an instant with its offset, converted by the server if needed
+		return t.writeTimestampTZValue(dt)
+	}
+}
+
+// Value encoders
+
+// writeKind writes the value type that precedes every value
+func (t *transfer) writeKind(kind int32) error {
+	err := t.writeInt32(kind)
+	if err != nil {
+		return errors.Wrapf(err, "can't write value type %d to socket", kind)
+	}
+	return nil
+}
+
+func (t *transfer) writeNullValue() error {
+	return t.writeKind(ValueNull)
+}
+
+func (t *transfer) writeBoolValue(v bool) error {
+	err := t.writeKind(ValueBoolean)
+	if err != nil {
+		return err
+	}
+	return t.writeBool(v)
+}
+
+func (t *transfer) writeByteValue(v int8) error {
+	err := t.writeKind(ValueByte)
+	if err != nil {
+		return err
+	}
+	return t.writeByte(byte(v))
+}
+
+func (t *transfer) writeShortValue(v int16) error {
+	err := t.writeKind(ValueShort)
+	if err != nil {
+		return err
+	}
+	// Shorts travel as 32 bits integers
+	return t.writeInt32(int32(v))
+}
+
+func (t *transfer) writeIntValue(v int32) error {
+	err := t.writeKind(ValueInt)
+	if err != nil {
+		return err
+	}
+	return t.writeInt32(v)
+}
+
+func (t *transfer) writeLongValue(v int64) error {
+	err := t.writeKind(ValueLong)
+	if err != nil {
+		return err
+	}
+	return t.writeInt64(v)
+}
+
+func (t *transfer) writeUnsignedValue(v uint64) error {
+	if v <= math.MaxInt64 {
+		return t.writeLongValue(int64(v))
+	}
+	// Doesn't fit in a BIGINT
+	err := t.writeKind(ValueDecimal)
+	if err != nil {
+		return err
+	}
+	return t.writeString(strconv.FormatUint(v, 10))
+}
+
+func (t *transfer) writeFloatValue(v float32) error {
+	err := t.writeKind(ValueFloat)
+	if err != nil {
+		return err
+	}
+	return t.writeFloat32(v)
+}
+
+func (t *transfer) writeDoubleValue(v float64) error {
+	err := t.writeKind(ValueDouble)
+	if err != nil {
+		return err
+	}
+	return t.writeFloat64(v)
+}
+
+func (t *transfer) writeStringValue(v string) error {
+	err := t.writeKind(ValueString)
+	if err != nil {
+		return err
+	}
+	return t.writeString(v)
+}
+
+func (t *transfer) writeBytesValue(v []byte) error {
+	err := t.writeKind(ValueBytes)
+	if err != nil {
+		return err
+	}
+	return t.writeBytes(v)
+}
+
+func (t *transfer) writeBigIntValue(v *big.Int) error {
+	if v.IsInt64() {
+		return t.writeLongValue(v.Int64())
+	}
+	err := t.writeKind(ValueDecimal)
+	if err != nil {
+		return err
+	}
+	return t.writeString(v.String())
+}
+
+func (t *transfer) writeDecimalValue(v Decimal) error {
+	err := t.writeKind(ValueDecimal)
+	if err != nil {
+		return err
+	}
+	return t.writeString(v.String())
+}
+
+func (t *transfer) writeUUIDValue(v UUID) error {
+	err := t.writeKind(ValueUUID)
+	if err != nil {
+		return err
+	}
+	high, low := v.halves()
+	err = t.writeInt64(high)
+	if err != nil {
+		return err
+	}
+	return t.writeInt64(low)
+}
+
+func (t *transfer) writeJSONValue(v json.RawMessage) error {
+	err := t.writeKind(ValueJSON)
+	if err != nil {
+		return err
+	}
+	return t.writeBytes(v)
+}
+
+func (t *transfer) writeArrayValue(v []interface{}) error {
+	err := t.writeKind(ValueArray)
+	if err != nil {
+		return err
+	}
+	err = t.writeInt32(int32(len(v)))
+	if err != nil {
+		return err
+	}
+	for i, elem := range v {
+		err = t.writeValue(elem)
 		if err != nil {
-			return err
+			return errors.Wrapf(err, "can't write array element %d", i)
 		}
-	case Time:
-		t.writeInt32(Time)
-		nsecBin := time2bin(&dt)
-		err = t.writeInt64(nsecBin)
-		if err != nil {
-			return err
+	}
+	return nil
+}
+
+func (t *transfer) writeGeometryValue(v Geometry) error {
+	err := t.writeKind(ValueGeometry)
+	if err != nil {
+		return err
+	}
+	return t.writeBytes(v)
+}
+
+// writeCivilValue writes a DATE (date value), TIME (nanoseconds) or TIMESTAMP (both)
+func (t *transfer) writeCivilValue(kind int32, n int64, nanos int64) error {
+	err := t.writeKind(kind)
+	if err != nil {
+		return err
+	}
+	err = t.writeInt64(n)
+	if err != nil || kind != ValueTimestamp {
+		return err
+	}
+	return t.writeInt64(nanos)
+}
+
+func (t *transfer) writeJavaObjectValue(v JavaObject) error {
+	err := t.writeKind(ValueJavaObject)
+	if err != nil {
+		return err
+	}
+	return t.writeBytes(v)
+}
+
+// writeLobValue writes a LOB read from the server by reference, or its data if it's in memory
+func (t *transfer) writeLobValue(v *Lob) error {
+	if v.data != nil {
+		if v.IsClob() {
+			return t.writeReaderValue(strings.NewReader(string(v.data)), true)
 		}
-	case TimeTZ:
-		t.writeInt32(TimeTZQuery)
-		nsecBin, offsetTZBin := timetz2bin(&dt)
-		err = t.writeInt64(nsecBin)
+		return t.writeReaderValue(bytes.NewReader(v.data), false)
+	}
+	err := t.writeKind(v.kind)
+	if err != nil {
+		return err
+	}
+	err = t.writeInt64(-1)
+	if err != nil {
+		return errors.Wrapf(err, "can't write LOB length")
+	}
+	err = t.writeInt32(v.tableID)
+	if err != nil {
+		return errors.Wrapf(err, "can't write LOB table ID")
+	}
+	err = t.writeInt64(v.lobID)
+	if err != nil {
+		return errors.Wrapf(err, "can't write LOB ID")
+	}
+	if t.version >= 12 {
+		err = t.writeBytes(v.hmac)
 		if err != nil {
-			return err
+			return errors.Wrapf(err, "can't write LOB HMAC")
 		}
-		err = t.writeInt32(offsetTZBin)
+	}
+	return t.writeInt64(v.precision)
+}
+
+// writeReaderValue streams a reader as a CLOB (UTF-8 text) or a BLOB
+func (t *transfer) writeReaderValue(r io.Reader, clob bool) error {
+	src, err := newLobSource(r, clob)
+	if err != nil {
+		return err
+	}
+	defer src.cleanup()
+	kind := ValueBlob
+	if clob {
+		kind = ValueClob
+	}
+	err = t.writeKind(kind)
+	if err != nil {
+		return err
+	}
+	err = t.writeInt64(src.length)
+	if err != nil {
+		return errors.Wrapf(err, "can't write LOB length")
+	}
+	var n int64
+	if clob {
+		n, err = writeChars(t.buff, src.r)
+	} else {
+		n, err = io.CopyN(t.buff, src.r, src.length)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "can't write LOB data")
+	}
+	if n != src.length {
+		return errors.Errorf("LOB length changed while sending it: %d != %d", n, src.length)
+	}
+	return t.writeInt32(lobMagic)
+}
+
+// writeDurationValue writes a duration as INTERVAL SECOND
+func (t *transfer) writeDurationValue(v time.Duration) error {
+	// Magnitude as unsigned to cover the minimum duration
+	n := uint64(v)
+	if v < 0 {
+		n = -n
+	}
+	return t.writeInterval(intervalSecond, v < 0, int64(n/uint64(time.Second)), int64(n%uint64(time.Second)))
+}
+
+// writeIntervalValue writes a year-month interval as INTERVAL YEAR TO MONTH
+func (t *transfer) writeIntervalValue(v Interval) error {
+	total := v.TotalMonths()
+	negative := total < 0
+	if negative {
+		total = -total
+	}
+	return t.writeInterval(intervalYearToMonth, negative, total/12, total%12)
+}
+
+func (t *transfer) writeInterval(qualifier int8, negative bool, leading int64, remaining int64) error {
+	err := t.writeKind(ValueInterval)
+	if err != nil {
+		return err
+	}
+	ordinal := qualifier
+	if negative {
+		ordinal = ^qualifier
+	}
+	err = t.writeByte(byte(ordinal))
+	if err != nil {
+		return errors.Wrapf(err, "can't write interval qualifier")
+	}
+	err = t.writeInt64(leading)
+	if err != nil {
+		return errors.Wrapf(err, "can't write interval leading field")
+	}
+	if qualifier >= intervalSecond {
+		err = t.writeInt64(remaining)
 		if err != nil {
-			return err
+			return errors.Wrapf(err, "can't write interval remaining field")
 		}
-	default:
-		return fmt.Errorf("Datatype unsupported: %d", mdp.kind)
 	}
 	return nil
 }
+
+func (t *transfer) writeDateValue(dt time.Time) error {
+	err := t.writeKind(ValueDate)
+	if err != nil {
+		return err
+	}
+	return t.writeInt64(date2bin(&dt))
+}
+
+func (t *transfer) writeTimestampValue(dt time.Time) error {
+	err := t.writeKind(ValueTimestamp)
+	if err != nil {
+		return err
+	}
+	if t.loc != nil {
+		dt = dt.In(t.loc)
+	}
+	dateBin, nsecBin := ts2bin(&dt)
+	err = t.writeInt64(dateBin)
+	if err != nil {
+		return err
+	}
+	return t.writeInt64(nsecBin)
+}
+
+func (t *transfer) writeTimestampTZValue(dt time.Time) error {
+	err := t.writeKind(ValueTimestampTZ)
+	if err != nil {
+		return err
+	}
+	dateBin, nsecBin, offsetTZBin := tsz2bin(&dt)
+	err = t.writeInt64(dateBin)
+	if err != nil {
+		return err
+	}
+	err = t.writeInt64(nsecBin)
+	if err != nil {
+		return err
+	}
+	return t.writeInt32(offsetTZBin)
+}
+
+func (t *transfer) writeTimeValue(dt time.Time) error {
+	err := t.writeKind(ValueTime)
+	if err != nil {
+		return err
+	}
+	return t.writeInt64(time2bin(&dt))
+}
+
+func (t *transfer) writeTimeTZValue(dt time.Time) error {
+	err := t.writeKind(ValueTimeTZQuery)
+	if err != nil {
+		return err
+	}
+	nsecBin, offsetTZBin := timetz2bin(&dt)
+	err = t.writeInt64(nsecBin)
+	if err != nil {
+		return err
+	}
+	return t.writeInt32(offsetTZBin)
+}
+
 func (t *transfer) readBytesDef(n int) ([]byte, error) {
 
 	buf := make([]byte, n)
-	n2, err := t.buff.Read(buf)
+	// Big values span several socket reads
+	n2, err := io.ReadFull(t.buff, buf)
 	if err != nil {
-		return nil, err
-	}
-	if n != n2 {
-		return nil, errors.Errorf("Read byte size differs: %d != %d", n, n2)
+		return nil, errors.Wrapf(err, "Read byte size differs: %d != %d", n, n2)
 	}
 	return buf, nil
 
@@ -517,14 +1201,11 @@ func (t *transfer) close() error {
 // Helpers
 
 func date2bin(dt *time.Time) int64 {
-	return int64((dt.Year() << 9) + (int(dt.Month()) << 5) + dt.Day())
+	return DateOf(*dt).dateValue()
 }
 
 func bin2date(n int64) time.Time {
-	day := int(n & 0x1f)
-	month := time.Month((n >> 5) & 0xf)
-	year := int(n >> 9)
-	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return dateFromValue(n).In(time.UTC)
 }
 
 func ts2bin(dt *time.Time) (int64, int64) {
@@ -536,33 +1217,13 @@ func ts2bin(dt *time.Time) (int64, int64) {
 	return dateBin, nsecBin
 }
 
-func bin2ts(dateBin int64, nsecBin int64) time.Time {
-	// TODO: optimization
-	day := int(dateBin & 0x1f)
-	month := time.Month((dateBin >> 5) & 0xf)
-	year := int(dateBin >> 9)
-	nsecs := int(nsecBin % int64(1e9))
-	nsecBin = nsecBin / int64(1e9)
-	sec := int(nsecBin % 60)
-	nsecBin = nsecBin / 60
-	minute := int(nsecBin % 60)
-	hour := int(nsecBin / 60)
-	return time.Date(year, month, day, hour, minute, sec, nsecs, time.UTC)
+func bin2ts(dateBin int64, nsecBin int64, loc *time.Location) time.Time {
+	return LocalDateTime{Date: dateFromValue(dateBin), Time: timeOfDayFromNanos(nsecBin)}.In(loc)
 }
 
 func bin2tsz(dateBin int64, nsecBin int64, secsTZ int32) time.Time {
-	// TODO: optimization
-	day := int(dateBin & 0x1f)
-	month := time.Month((dateBin >> 5) & 0xf)
-	year := int(dateBin >> 9)
-	nsecs := int(nsecBin % int64(1e9))
-	nsecBin = nsecBin / int64(1e9)
-	sec := int(nsecBin % 60)
-	nsecBin = nsecBin / 60
-	minute := int(nsecBin % 60)
-	hour := int(nsecBin / 60)
 	tz := time.FixedZone(fmt.Sprintf("tz_%d", secsTZ), int(secsTZ))
-	return time.Date(year, month, day, hour, minute, sec, nsecs, tz)
+	return LocalDateTime{Date: dateFromValue(dateBin), Time: timeOfDayFromNanos(nsecBin)}.In(tz)
 }
 
 func tsz2bin(dt *time.Time) (int64, int64, int32) {
@@ -17,66 +17,46 @@ limitations under the License.
 package h2go
 
 import (
+	"context"
 	"database/sql/driver"
-
-	log "github.com/sirupsen/logrus"
 )
 
 type h2tx struct {
 	conn h2Conn
+	// Context of BeginTx, for the hook
+	ctx context.Context
 	// Interfaces
 	driver.Tx
 }
 
 // Interface Tx
 func (h2t h2tx) Commit() error {
-	L(log.DebugLevel, "Commit")
-	stmt, err := h2t.conn.client.sess.prepare2(&h2t.conn.client.trans, "COMMIT")
-	if err != nil {
-		return err
-	}
-	st, _ := stmt.(h2stmt)
-	_, err = h2t.conn.client.sess.executeQueryUpdate(&st, &h2t.conn.client.trans, []driver.Value{})
-	if err != nil {
-		return err
-	}
-	err = h2t.restoreAutocommit()
-	if err != nil {
-		return err
-	}
-	return nil
+	h2t.conn.client.trans.L(LogDebug, "Commit")
+	hc := startHook(h2t.ctx, h2t.conn.client.hook, OpCommit, "COMMIT", 0)
+	err := h2t.finish("COMMIT")
+	hc.end(0, err)
+	return err
 }
 
 func (h2t h2tx) Rollback() error {
-	L(log.DebugLevel, "Rollback")
-	stmt, err := h2t.conn.client.sess.prepare2(&h2t.conn.client.trans, "ROLLBACK")
-	if err != nil {
-		return err
-	}
-	st, _ := stmt.(h2stmt)
-	_, err = h2t.conn.client.sess.executeQueryUpdate(&st, &h2t.conn.client.trans, []driver.Value{})
-	if err != nil {
-		return err
-	}
-	err = h2t.restoreAutocommit()
-	if err != nil {
-		return err
-	}
-	return nil
+	h2t.conn.client.trans.L(LogDebug, "Rollback")
+	hc := startHook(h2t.ctx, h2t.conn.client.hook, OpRollback, "ROLLBACK", 0)
+	err := h2t.finish("ROLLBACK")
+	hc.end(0, err)
+	return err
 }
 
 // Helpers
 
-func (h2t h2tx) restoreAutocommit() error {
-	stmt, err := h2t.conn.client.sess.prepare2(&h2t.conn.client.trans, "SET AUTOCOMMIT TRUE")
-	if err != nil {
-		return err
-	}
-	st, _ := stmt.(h2stmt)
-	_, err = h2t.conn.client.sess.executeQueryUpdate(&st, &h2t.conn.client.trans, []driver.Value{})
+// finish ends the transaction with COMMIT or ROLLBACK
+func (h2t h2tx) finish(sql string) error {
+	_, err := h2t.conn.client.execOnce(sql)
 	if err != nil {
 		return err
 	}
-	return nil
+	return h2t.restoreAutocommit()
+}
 
+func (h2t h2tx) restoreAutocommit() error {
+	return h2t.conn.client.setAutoCommit(true)
 }
@@ -21,7 +21,6 @@ import (
 	"fmt"
 	"strings"
 
-	log "github.com/sirupsen/logrus"
 	"golang.org/x/text/encoding/unicode"
 )
 
@@ -33,11 +32,3 @@ func getHashedPassword(username string, password string) ([32]byte, error) {
 	}
 	return sha256.Sum256(data), nil
 }
-
-// L Log if apply
-func L(level log.Level, text string, args ...interface{}) {
-	if !doLogging {
-		return
-	}
-	log.StandardLogger().Logf(level, text, args...)
-}
@@ -0,0 +1,96 @@
+/*
+Copyright 2020 JM Robles (@jmrobles)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package h2go
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// UUID is a H2 UUID value. UUID columns are read as strings in canonical form, so they can be
+// scanned into a string; scan them into a UUID to get the 16 bytes.
+type UUID [16]byte
+
+// ParseUUID parses a UUID in canonical form (xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx) or as 32 hex digits
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	text := strings.Replace(s, "-", "", -1)
+	if len(text) != 32 {
+		return u, errors.Errorf("invalid UUID: %s", s)
+	}
+	_, err := hex.Decode(u[:], []byte(text))
+	if err != nil {
+		return u, errors.Errorf("invalid UUID: %s", s)
+	}
+	return u, nil
+}
+
+// String gets the UUID in canonical form
+func (u UUID) String() string {
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf)
+}
+
+// Scan implements sql.Scanner
+func (u *UUID) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case string:
+		*u, err = ParseUUID(v)
+	case []byte:
+		if len(v) == 16 {
+			copy(u[:], v)
+			return nil
+		}
+		*u, err = ParseUUID(string(v))
+	case nil:
+		return errors.Errorf("can't scan NULL into UUID")
+	default:
+		return errors.Errorf("can't scan %T into UUID", src)
+	}
+	return err
+}
+
+// Value implements driver.Valuer
+func (u UUID) Value() (driver.Value, error) {
+	return u.String(), nil
+}
+
+// H2 sends UUIDs as two longs: most and least significant bits
+func (u UUID) halves() (int64, int64) {
+	return int64(binary.BigEndian.Uint64(u[:8])), int64(binary.BigEndian.Uint64(u[8:]))
+}
+
+func uuidFromHalves(high int64, low int64) UUID {
+	var u UUID
+	binary.BigEndian.PutUint64(u[:8], uint64(high))
+	binary.BigEndian.PutUint64(u[8:], uint64(low))
+	return u
+}